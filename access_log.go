@@ -0,0 +1,72 @@
+package cube_http_gateway
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+//Response writer remembering status and size for access log
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	size, err := w.ResponseWriter.Write(data)
+	w.size += size
+	return size, err
+}
+
+//Event streams need flushing
+func (w *accessLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Websocket handshake needs connection hijacking
+func (w *accessLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection can't be hijacked")
+	}
+
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+
+	return hijacker.Hijack()
+}
+
+//Lets http.ResponseController reach flush and deadlines of underlying writer
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (h *Handler) logAccess(writer *accessLogWriter, request *http.Request, startTime time.Time) {
+	h.cubeInstance.LogInfo(fmt.Sprintf("%v %v %v %v %v %v %vms",
+		request.RemoteAddr,
+		request.Method,
+		request.RequestURI,
+		request.Proto,
+		writer.status,
+		writer.size,
+		time.Since(startTime).Nanoseconds()/int64(time.Millisecond),
+	))
+}
@@ -0,0 +1,32 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAccessLogWriterSupportsResponseController(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		controller := http.NewResponseController(&accessLogWriter{ResponseWriter: writer})
+
+		err := controller.SetWriteDeadline(time.Now().Add(time.Second))
+		if err != nil {
+			t.Errorf("expected write deadline to reach connection: %v", err)
+		}
+
+		err = controller.Flush()
+		if err != nil {
+			t.Errorf("expected flush to reach connection: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+}
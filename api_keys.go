@@ -0,0 +1,100 @@
+package cube_http_gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const apiKeyHeader = "X-Api-Key"
+
+type apiKey struct {
+	Id        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	OwnerId   string     `json:"ownerId"`
+	Routes    []Uri      `json:"routes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Tier      string     `json:"tier"`
+}
+
+type apiKeyStore struct {
+	keysByHash map[string]*apiKey
+	limiter    *rateLimiter
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+//Key store file is json array of keys, hash is hex encoded sha256 of the key
+func loadApiKeyStore(path string, tiers map[string]int) (*apiKeyStore, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*apiKey
+
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("wrong api keys file: %v", err)
+	}
+
+	keysByHash := map[string]*apiKey{}
+
+	for _, key := range keys {
+		if key.Id == "" || key.Hash == "" {
+			return nil, fmt.Errorf("api key without id or hash")
+		}
+
+		//Key without routes could not be used for any request
+		if len(key.Routes) == 0 {
+			return nil, fmt.Errorf("api key without routes: %v", key.Id)
+		}
+
+		keysByHash[key.Hash] = key
+	}
+
+	return &apiKeyStore{
+		keysByHash: keysByHash,
+		limiter:    newRateLimiter(tiers),
+	}, nil
+}
+
+func (s *apiKeyStore) authenticate(request *http.Request) (*identity, error) {
+	rawKey := request.Header.Get(apiKeyHeader)
+	if rawKey == "" {
+		return nil, nil
+	}
+
+	key := s.keysByHash[hashApiKey(rawKey)]
+	if key == nil {
+		return nil, fmt.Errorf("unknown api key")
+	}
+
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("api key is expired")
+	}
+
+	if !matchAnyUri(key.Routes, requestPath(request)) {
+		return nil, &statusError{status: http.StatusForbidden, reason: "route is not allowed for api key"}
+	}
+
+	if !s.limiter.allow(key.Id, key.Tier) {
+		return nil, &statusError{status: http.StatusTooManyRequests, reason: "api key rate limit exceeded"}
+	}
+
+	keyId := key.Id
+	ownerId := key.OwnerId
+
+	return &identity{
+		method:   authMethodApiKey,
+		clientId: &ownerId,
+		apiKeyId: &keyId,
+	}, nil
+}
@@ -0,0 +1,80 @@
+package cube_http_gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func newTestApiKeyStore(t *testing.T, keys string) (*apiKeyStore, error) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+
+	err := ioutil.WriteFile(keysFile, []byte(keys), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loadApiKeyStore(keysFile, map[string]int{"basic": 2})
+}
+
+func TestApiKeyStoreRejectsKeysWithoutRoutes(t *testing.T) {
+	_, err := newTestApiKeyStore(t, `[{"id": "key", "hash": "`+hashApiKey("secret")+`"}]`)
+	if err == nil {
+		t.Fatal("expected key without routes to be rejected")
+	}
+}
+
+func TestApiKeyStoreAuthenticate(t *testing.T) {
+	store, err := newTestApiKeyStore(t, `[
+		{"id": "active", "hash": "`+hashApiKey("active-key")+`", "ownerId": "partner", "routes": ["/orders"], "tier": "basic"},
+		{"id": "expired", "hash": "`+hashApiKey("expired-key")+`", "ownerId": "partner", "routes": ["/orders"], "expiresAt": "2000-01-01T00:00:00Z"},
+		{"id": "unlimited", "hash": "`+hashApiKey("unlimited-key")+`", "ownerId": "partner", "routes": ["/orders"], "tier": "premium"}
+	]`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		target string
+		status int
+	}{
+		{"valid key", "active-key", "/orders", http.StatusOK},
+		{"hash is not accepted as key", hashApiKey("active-key"), "/orders", http.StatusUnauthorized},
+		{"unknown key", "unknown-key", "/orders", http.StatusUnauthorized},
+		{"expired key", "expired-key", "/orders", http.StatusUnauthorized},
+		{"route is not allowed", "active-key", "/users", http.StatusForbidden},
+		{"second request within tier limit", "active-key", "/orders", http.StatusOK},
+		{"tier limit exceeded", "active-key", "/orders", http.StatusTooManyRequests},
+		{"tier without limit", "unlimited-key", "/orders", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", test.target, nil)
+			request.Header.Set(apiKeyHeader, test.key)
+
+			identity, err := store.authenticate(request)
+
+			status := http.StatusOK
+			if err != nil {
+				status = http.StatusUnauthorized
+				if statusErr, ok := err.(*statusError); ok {
+					status = statusErr.status
+				}
+			}
+
+			if status != test.status {
+				t.Fatalf("expected status %v, got %v (%v)", test.status, status, err)
+			}
+
+			if status == http.StatusOK && (identity == nil || *identity.clientId != "partner" || identity.apiKeyId == nil) {
+				t.Fatalf("expected identity of partner, got %v", identity)
+			}
+		})
+	}
+}
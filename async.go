@@ -0,0 +1,33 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const requestIdHeader = "X-Request-Id"
+
+//Publishes request without waiting for reply, backend gets generated id as message id
+func (h *Handler) publishAsync(writer http.ResponseWriter, channel cube.Channel, requestData *cube.Request) {
+	messageId := uuid.NewV4().String()
+
+	err := h.cubeInstance.PublishMessage(channel, cube.Message{
+		Id:     messageId,
+		Method: requestData.Method,
+		Params: requestData.Params,
+	})
+
+	if err != nil {
+		h.cubeInstance.LogError("Can't publish async request: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	writer.Header().Set(requestIdHeader, messageId)
+	writeJson(writer, http.StatusAccepted, js.AcceptedResult{Id: messageId})
+}
@@ -0,0 +1,329 @@
+package cube_http_gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/akaumov/cube"
+)
+
+const (
+	authMethodJwt        = "jwt"
+	authMethodApiKey     = "apiKey"
+	authMethodBasic      = "basic"
+	authMethodClientCert = "clientCert"
+	authMethodDelegated  = "delegated"
+	authMethodHmac       = "hmac"
+	authMethodSignedUrl  = "signedUrl"
+	authMethodSession    = "session"
+)
+
+//Authenticated caller of request
+type identity struct {
+	method   string
+	userId   *string
+	deviceId *string
+	clientId *string
+	apiKeyId *string
+	scopes   []string
+
+	tokenSource       string
+	deviceFingerprint string
+
+	//Refreshed credentials cookie set on response
+	cookie *http.Cookie
+}
+
+//Authenticator returns nil identity when request has no credentials it handles
+type authenticator interface {
+	authenticate(request *http.Request) (*identity, error)
+}
+
+//Error with http status it must be reported with
+type statusError struct {
+	status    int
+	reason    string
+	challenge string
+}
+
+func (e *statusError) Error() string {
+	return e.reason
+}
+
+func writeStatusError(writer http.ResponseWriter, err error) {
+	status := http.StatusUnauthorized
+
+	if statusErr, ok := err.(*statusError); ok {
+		status = statusErr.status
+
+		if statusErr.challenge != "" {
+			writer.Header().Set("WWW-Authenticate", statusErr.challenge)
+		}
+	}
+
+	http.Error(writer,
+		http.StatusText(status),
+		status)
+}
+
+//Returned by token validator for token not issued by its authority, next validator is tried then.
+//Other errors reject token
+var errTokenNotRecognized = errors.New("token is not recognized")
+
+//Returned by token validator for token of its authority which is invalid or inactive.
+//Next validator is still tried, first rejection is reported if no validator accepts token
+type tokenRejectedError struct {
+	reason string
+}
+
+func (e *tokenRejectedError) Error() string {
+	return e.reason
+}
+
+type tokenValidator interface {
+	validateToken(token string) (*identity, error)
+}
+
+type jwtValidator struct {
+	handler *Handler
+}
+
+func (v *jwtValidator) validateToken(token string) (*identity, error) {
+	if strings.Count(token, ".") != 2 {
+		return nil, errTokenNotRecognized
+	}
+
+	return v.handler.getAuthData(token)
+}
+
+//Format: "jwt;delegated;introspection", validators are tried in order
+func (h *Handler) parseTokenValidators(cubeInstance cube.Cube) ([]tokenValidator, error) {
+	rawValidators := cubeInstance.GetParam("tokenValidators")
+	if rawValidators == "" {
+		rawValidators = authMethodJwt
+	}
+
+	validators := []tokenValidator{}
+
+	for _, name := range strings.Split(rawValidators, ";") {
+		switch name {
+		case authMethodJwt:
+			if h.jwtSecret != "" {
+				validators = append(validators, &jwtValidator{handler: h})
+			}
+
+		case authMethodDelegated:
+			delegatedAuth, err := newDelegatedAuth(cubeInstance, time.Duration(h.timeoutMs)*time.Millisecond)
+			if err != nil {
+				return nil, err
+			}
+
+			validators = append(validators, delegatedAuth)
+
+		case authMethodIntrospection:
+			introspection, err := newIntrospectionValidator(cubeInstance, time.Duration(h.timeoutMs)*time.Millisecond)
+			if err != nil {
+				return nil, err
+			}
+
+			validators = append(validators, introspection)
+
+		default:
+			return nil, fmt.Errorf("Unknown token validator: %v\n", name)
+		}
+	}
+
+	return validators, nil
+}
+
+type bearerAuthenticator struct {
+	handler    *Handler
+	validators []tokenValidator
+}
+
+func (a *bearerAuthenticator) authenticate(request *http.Request) (*identity, error) {
+	token, source := a.handler.extractToken(request)
+	if token == "" || len(a.validators) == 0 {
+		return nil, nil
+	}
+
+	var rejection error
+
+	for _, validator := range a.validators {
+		identity, err := validator.validateToken(token)
+		if err == errTokenNotRecognized {
+			continue
+		}
+
+		if _, ok := err.(*tokenRejectedError); ok {
+			if rejection == nil {
+				rejection = err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if identity != nil {
+			err = a.handler.checkDeviceBinding(request, identity)
+			if err != nil {
+				return nil, err
+			}
+
+			tokenIdentity := *identity
+			tokenIdentity.tokenSource = source.kind
+			return &tokenIdentity, nil
+		}
+	}
+
+	if rejection != nil {
+		return nil, rejection
+	}
+
+	return nil, fmt.Errorf("unsupported token")
+}
+
+//Authenticators are asked in order, first one recognizing credentials wins.
+//Returns nil identity for anonymous requests
+func (h *Handler) authenticate(writer http.ResponseWriter, request *http.Request) (*identity, error) {
+
+	for _, authenticator := range h.authenticators {
+		identity, err := authenticator.authenticate(request)
+		if err != nil {
+			return nil, err
+		}
+
+		if identity != nil {
+			if identity.cookie != nil {
+				http.SetCookie(writer, identity.cookie)
+			}
+
+			return identity, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (h *Handler) initAuthenticators(cubeInstance cube.Cube) error {
+	h.authenticators = []authenticator{}
+
+	tokenSources, err := parseTokenSources(cubeInstance.GetParam("tokenSources"))
+	if err != nil {
+		return err
+	}
+
+	h.tokenSources = tokenSources
+	h.queryTokenRoutes = parseUriList(cubeInstance.GetParam("queryTokenRoutes"))
+
+	sessionAuth, err := h.newSessionAuthenticator(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	cookieAuth := sessionAuth != nil
+
+	for _, source := range tokenSources {
+		if source.kind == tokenSourceCookie {
+			cookieAuth = true
+		}
+	}
+
+	if cookieAuth {
+		h.csrf, err = newCsrfConfig(cubeInstance)
+		if err != nil {
+			return err
+		}
+	}
+
+	clientCertRules, err := parseClientCertRules(cubeInstance.GetParam("clientCertRoutes"))
+	if err != nil {
+		return err
+	}
+
+	if len(clientCertRules) > 0 {
+		if h.tlsConfig == nil || h.tlsConfig.ClientCAs == nil {
+			return fmt.Errorf("client cert routes require tls and client ca file")
+		}
+
+		h.authenticators = append(h.authenticators, &clientCertAuthenticator{rules: clientCertRules})
+	}
+
+	apiKeysFile := cubeInstance.GetParam("apiKeysFile")
+	if apiKeysFile != "" {
+		tiers, err := parseRateLimitTiers(cubeInstance.GetParam("apiKeyTiers"))
+		if err != nil {
+			return err
+		}
+
+		apiKeys, err := loadApiKeyStore(apiKeysFile, tiers)
+		if err != nil {
+			cubeInstance.LogError("Wrong api keys file")
+			return err
+		}
+
+		h.authenticators = append(h.authenticators, apiKeys)
+	}
+
+	if h.signedUrlSecret != "" {
+		h.authenticators = append(h.authenticators, &signedUrlAuthenticator{secret: h.signedUrlSecret})
+	}
+
+	hmacSecretsFile := cubeInstance.GetParam("hmacSecretsFile")
+	if hmacSecretsFile != "" {
+		replayWindow, err := getDurationMsParam(cubeInstance, "hmacReplayWindowMs", defaultHmacReplayWindow)
+		if err != nil {
+			return err
+		}
+
+		hmacAuth, err := newHmacAuthenticator(hmacSecretsFile, replayWindow, h.stop)
+		if err != nil {
+			cubeInstance.LogError("Wrong hmac secrets file")
+			return err
+		}
+
+		h.authenticators = append(h.authenticators, hmacAuth)
+	}
+
+	htpasswdFile := cubeInstance.GetParam("htpasswdFile")
+	if htpasswdFile != "" {
+		basicAuth, err := newBasicAuthenticator(htpasswdFile, parseUriList(cubeInstance.GetParam("basicAuthRoutes")))
+		if err != nil {
+			cubeInstance.LogError("Wrong htpasswd file")
+			return err
+		}
+
+		go watchFile(htpasswdFile, 5*time.Second, func() {
+			err := basicAuth.load(htpasswdFile)
+			if err != nil {
+				cubeInstance.LogError("Can't reload htpasswd file: " + err.Error())
+				return
+			}
+
+			cubeInstance.LogInfo("Htpasswd file is reloaded")
+		}, h.stop)
+
+		h.authenticators = append(h.authenticators, basicAuth)
+	}
+
+	if sessionAuth != nil {
+		h.authenticators = append(h.authenticators, sessionAuth)
+	}
+
+	validators, err := h.parseTokenValidators(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	h.authenticators = append(h.authenticators, &bearerAuthenticator{
+		handler:    h,
+		validators: validators,
+	})
+	return nil
+}
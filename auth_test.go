@@ -0,0 +1,187 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func TestTokenValidatorsFallThroughForUnrecognizedTokens(t *testing.T) {
+	introspections := 0
+	activeTokens := map[string]bool{"opaque": true}
+
+	introspectionServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		introspections++
+		request.ParseForm()
+
+		json.NewEncoder(writer).Encode(introspectionResponse{
+			Active:  activeTokens[request.PostForm.Get("token")],
+			Subject: "user",
+		})
+	}))
+	defer introspectionServer.Close()
+
+	handler, fake := newTestHandler(t, map[string]string{
+		"tokenValidators":  "jwt;delegated;introspection",
+		"authSubject":      "auth",
+		"introspectionUrl": introspectionServer.URL,
+	})
+
+	delegations := 0
+	fake.call = func(channel cube.Channel, request cube.Request) (*cube.Response, error) {
+		if channel != "auth" {
+			return echoChannelCall(channel, request)
+		}
+
+		delegations++
+		response := cube.NewErrorResponse("", authErrorInvalidToken, "")
+		return &response, nil
+	}
+
+	validToken := newTestToken(t, handler, "user")
+
+	handler.jwtSecret = "other-issuer-secret"
+	foreignToken := newTestToken(t, handler, "user")
+	activeTokens[foreignToken] = true
+	handler.jwtSecret = "test-secret"
+
+	handler.accessTokenLifetime = -time.Hour
+	expiredToken := newTestToken(t, handler, "user")
+
+	tests := []struct {
+		name           string
+		token          string
+		status         int
+		delegations    int
+		introspections int
+	}{
+		{"own jwt", validToken, http.StatusOK, 0, 0},
+		{"expired own jwt is final", expiredToken, http.StatusUnauthorized, 0, 0},
+		{"jwt of other issuer", foreignToken, http.StatusOK, 1, 1},
+		{"opaque token", "opaque", http.StatusOK, 1, 1},
+		{"unknown token", "unknown", http.StatusUnauthorized, 1, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delegations = 0
+			introspections = 0
+
+			request := httptest.NewRequest("GET", "/orders", nil)
+			request.Header.Set("Authorization", "Bearer "+test.token)
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			if writer.Code != test.status || delegations != test.delegations || introspections != test.introspections {
+				t.Fatalf("expected %v with %v delegations and %v introspections, got %v with %v and %v",
+					test.status, test.delegations, test.introspections, writer.Code, delegations, introspections)
+			}
+		})
+	}
+}
+
+type testTokenValidator struct {
+	identity *identity
+	err      error
+}
+
+func (v *testTokenValidator) validateToken(token string) (*identity, error) {
+	return v.identity, v.err
+}
+
+func TestTokenValidatorsReportFirstRejection(t *testing.T) {
+	handler, _ := newTestHandler(t, nil)
+
+	userId := "user"
+	notRecognized := &testTokenValidator{err: errTokenNotRecognized}
+	inactive := &testTokenValidator{err: errTokenInactive}
+	rejected := &testTokenValidator{err: errTokenRejectedByAuthSubject}
+	accepting := &testTokenValidator{identity: &identity{method: authMethodIntrospection, userId: &userId}}
+
+	tests := []struct {
+		name       string
+		validators []tokenValidator
+		err        string
+	}{
+		{"not recognized", []tokenValidator{notRecognized}, "unsupported token"},
+		{"first rejection", []tokenValidator{notRecognized, inactive, rejected}, errTokenInactive.reason},
+		{"rejected token accepted by next validator", []tokenValidator{rejected, accepting}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authenticator := &bearerAuthenticator{handler: handler, validators: test.validators}
+
+			request := httptest.NewRequest("GET", "/orders", nil)
+			request.Header.Set("Authorization", "Bearer token")
+
+			identity, err := authenticator.authenticate(request)
+
+			if test.err == "" {
+				if err != nil || identity == nil {
+					t.Fatalf("expected token to be accepted, got %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestQueryTokenIsStrippedFromEveryRequest(t *testing.T) {
+	handler, fake := newTestHandler(t, map[string]string{
+		"tokenSources":     "header;query:access_token",
+		"queryTokenRoutes": "/orders/export",
+		"endpointsMap":     "/orders:orders;/orders/export?format=csv:orders",
+	})
+
+	var requestUri string
+	fake.call = func(channel cube.Channel, request cube.Request) (*cube.Response, error) {
+		var params js.RequestParams
+		json.Unmarshal(*request.Params, &params)
+		requestUri = params.RequestURI
+
+		return echoChannelCall(channel, request)
+	}
+
+	token := newTestToken(t, handler, "user")
+
+	tests := []struct {
+		name       string
+		target     string
+		header     string
+		status     int
+		requestUri string
+	}{
+		{"query token on query token route", "/orders/export?access_token=" + token + "&format=csv", "", http.StatusOK, "/orders/export?format=csv"},
+		{"header wins over query token", "/orders/export?access_token=wrong&format=csv", "Bearer " + token, http.StatusOK, "/orders/export?format=csv"},
+		{"query token outside of query token routes", "/orders?access_token=" + token, "Bearer " + token, http.StatusOK, "/orders"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestUri = ""
+
+			request := httptest.NewRequest("GET", test.target, nil)
+			if test.header != "" {
+				request.Header.Set("Authorization", test.header)
+			}
+
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, request)
+
+			if writer.Code != test.status || requestUri != test.requestUri {
+				t.Fatalf("expected %v with %v, got %v with %v", test.status, test.requestUri, writer.Code, requestUri)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cube_http_gateway
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const basicAuthChallenge = `Basic realm="gateway"`
+
+//Unknown users are checked against this hash so response time doesn't reveal existing usernames
+var basicAuthDummyHash = []byte("$2a$10$Er9MiuDEG7d.DqBqP/tSLusbFnlOr2IWxeAaXPLFpYUcOcsrffU9m")
+
+type basicAuthenticator struct {
+	routes []Uri
+	mutex  sync.RWMutex
+	users  map[string][]byte
+}
+
+//Htpasswd file contains "username:bcryptHash" lines
+func parseHtpasswd(data []byte) (map[string][]byte, error) {
+	users := map[string][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		splittedLine := strings.SplitN(line, ":", 2)
+		if len(splittedLine) != 2 {
+			return nil, fmt.Errorf("Wrong htpasswd line: %v\n", line)
+		}
+
+		hash := splittedLine[1]
+		if !strings.HasPrefix(hash, "$2") {
+			return nil, fmt.Errorf("Only bcrypt hashes are supported: %v\n", splittedLine[0])
+		}
+
+		users[splittedLine[0]] = []byte(hash)
+	}
+
+	return users, scanner.Err()
+}
+
+func newBasicAuthenticator(path string, routes []Uri) (*basicAuthenticator, error) {
+	authenticator := &basicAuthenticator{
+		routes: routes,
+	}
+
+	err := authenticator.load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return authenticator, nil
+}
+
+func (a *basicAuthenticator) load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	users, err := parseHtpasswd(data)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	a.users = users
+	a.mutex.Unlock()
+
+	return nil
+}
+
+func (a *basicAuthenticator) authenticate(request *http.Request) (*identity, error) {
+	if !matchAnyUri(a.routes, requestPath(request)) {
+		return nil, nil
+	}
+
+	username, password, ok := request.BasicAuth()
+	if !ok {
+		return nil, &statusError{status: http.StatusUnauthorized, reason: "basic credentials are required", challenge: basicAuthChallenge}
+	}
+
+	a.mutex.RLock()
+	hash := a.users[username]
+	a.mutex.RUnlock()
+
+	if hash == nil {
+		bcrypt.CompareHashAndPassword(basicAuthDummyHash, []byte(password))
+		return nil, &statusError{status: http.StatusUnauthorized, reason: "unknown user", challenge: basicAuthChallenge}
+	}
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil {
+		return nil, &statusError{status: http.StatusUnauthorized, reason: "wrong password", challenge: basicAuthChallenge}
+	}
+
+	return &identity{
+		method:   authMethodBasic,
+		clientId: &username,
+	}, nil
+}
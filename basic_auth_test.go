@@ -0,0 +1,69 @@
+package cube_http_gateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthentication(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	err = ioutil.WriteFile(path, []byte("admin:"+string(hash)+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := newBasicAuthenticator(path, []Uri{"/admin*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		status   int
+	}{
+		{"valid credentials", "admin", "secret", 0},
+		{"wrong password", "admin", "wrong", http.StatusUnauthorized},
+		{"unknown user", "guest", "secret", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/admin/users", nil)
+			request.SetBasicAuth(test.username, test.password)
+
+			identity, err := authenticator.authenticate(request)
+
+			if test.status == 0 {
+				if err != nil || identity == nil || *identity.clientId != test.username {
+					t.Fatalf("expected identity of %v, got %v %v", test.username, identity, err)
+				}
+				return
+			}
+
+			statusErr, ok := err.(*statusError)
+			if !ok || statusErr.status != test.status || statusErr.challenge != basicAuthChallenge {
+				t.Fatalf("expected %v with challenge, got %v", test.status, err)
+			}
+		})
+	}
+}
+
+func TestBasicAuthDummyHashCostsAsRealHash(t *testing.T) {
+	cost, err := bcrypt.Cost(basicAuthDummyHash)
+	if err != nil || cost != bcrypt.DefaultCost {
+		t.Fatalf("expected valid bcrypt hash with default cost, got %v %v", cost, err)
+	}
+}
@@ -0,0 +1,343 @@
+package cube_http_gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchMaxRequests = 20
+	maxBatchBodySize        = 10 << 20
+)
+
+//Headers carrying credentials and request origin are always taken from batch request,
+//otherwise cross-site page could forge them per item
+var batchProtectedHeaders = map[string]bool{
+	"Authorization": true,
+	"Cookie":        true,
+	"Host":          true,
+	"Origin":        true,
+	"Referer":       true,
+}
+
+//Collects response of sub request
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(data)
+}
+
+func (w *batchResponseWriter) result(id string) js.BatchResult {
+	result := js.BatchResult{
+		Id:      id,
+		Status:  w.status,
+		Headers: map[string]string{},
+	}
+
+	for key := range w.header {
+		result.Headers[key] = w.header.Get(key)
+	}
+
+	body := w.body.Bytes()
+
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		result.Body = json.RawMessage(body)
+	default:
+		result.Body, _ = json.Marshal(string(body))
+	}
+
+	return result
+}
+
+//Returns error for unknown dependencies and cycles
+func checkBatchDependencies(items []js.BatchItem) error {
+	indexes := map[string]int{}
+
+	for i, item := range items {
+		if item.Id == "" {
+			continue
+		}
+
+		if _, ok := indexes[item.Id]; ok {
+			return fmt.Errorf("duplicated batch item id %v", item.Id)
+		}
+
+		indexes[item.Id] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	states := make([]int, len(items))
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch states[i] {
+		case visiting:
+			return fmt.Errorf("dependency cycle at batch item %v", items[i].Id)
+		case visited:
+			return nil
+		}
+
+		states[i] = visiting
+
+		for _, dependency := range items[i].DependsOn {
+			index, ok := indexes[dependency]
+			if !ok {
+				return fmt.Errorf("unknown batch dependency %v", dependency)
+			}
+
+			err := visit(index)
+			if err != nil {
+				return err
+			}
+		}
+
+		states[i] = visited
+		return nil
+	}
+
+	for i := range items {
+		err := visit(i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Sub request inherits credentials and connection data of batch request
+func newBatchSubRequest(request *http.Request, item js.BatchItem) (*http.Request, error) {
+	body := []byte(item.Body)
+
+	//String body is forwarded as is, other json values as json
+	var stringBody string
+	if json.Unmarshal(item.Body, &stringBody) == nil {
+		body = []byte(stringBody)
+	}
+
+	method := item.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	subRequest, err := http.NewRequest(method, item.Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(body) == 0 {
+		subRequest.Body = nil
+	}
+
+	for key, values := range request.Header {
+		if key == "Content-Length" {
+			continue
+		}
+
+		subRequest.Header[key] = values
+	}
+
+	for key, value := range item.Headers {
+		if batchProtectedHeaders[http.CanonicalHeaderKey(key)] {
+			return nil, fmt.Errorf("header %v can't be set in batch item", key)
+		}
+
+		subRequest.Header.Set(key, value)
+	}
+
+	subRequest.Host = request.Host
+	subRequest.RemoteAddr = request.RemoteAddr
+	subRequest.RequestURI = item.Path
+	subRequest.TLS = request.TLS
+	subRequest.Proto = request.Proto
+	subRequest.ProtoMajor = request.ProtoMajor
+	subRequest.ProtoMinor = request.ProtoMinor
+
+	return subRequest.WithContext(request.Context()), nil
+}
+
+func (h *Handler) serveBatchItem(request *http.Request, item js.BatchItem) js.BatchResult {
+	writer := &batchResponseWriter{header: http.Header{}}
+
+	subRequest, err := newBatchSubRequest(request, item)
+	if err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return writer.result(item.Id)
+	}
+
+	//Gateway routes, batch itself included, are not available in batch
+	if h.findGatewayRoute(requestPath(subRequest)) != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return writer.result(item.Id)
+	}
+
+	h.ServeHTTP(writer, subRequest)
+
+	if writer.status == 0 {
+		writer.status = http.StatusOK
+	}
+
+	return writer.result(item.Id)
+}
+
+func (h *Handler) serveBatch(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	//Sub requests reuse credentials of batch request, so it is checked as state-changing request itself
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	err = h.checkCsrf(writer, request, identity)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, maxBatchBodySize))
+	if err != nil {
+		http.Error(writer,
+			http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var items []js.BatchItem
+
+	err = json.Unmarshal(data, &items)
+	if err != nil || len(items) > h.batchMaxRequests {
+		http.Error(writer,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest)
+		return
+	}
+
+	err = checkBatchDependencies(items)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	//Dependencies refer to explicit ids, items without id are reported by index
+	ids := map[string]int{}
+	for i, item := range items {
+		if item.Id != "" {
+			ids[item.Id] = i
+			continue
+		}
+
+		items[i].Id = strconv.Itoa(i)
+	}
+
+	results := make([]js.BatchResult, len(items))
+	done := make([]chan struct{}, len(items))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	slots := make(chan struct{}, h.batchConcurrency)
+
+	var wg sync.WaitGroup
+
+	for i := range items {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+
+			item := items[i]
+
+			//Item is not sent if any dependency failed
+			for _, dependency := range item.DependsOn {
+				index := ids[dependency]
+				<-done[index]
+
+				if results[index].Status >= 400 {
+					results[i] = js.BatchResult{Id: item.Id, Status: http.StatusFailedDependency}
+					return
+				}
+			}
+
+			slots <- struct{}{}
+			results[i] = h.serveBatchItem(request, item)
+			<-slots
+		}(i)
+	}
+
+	wg.Wait()
+
+	writeJson(writer, http.StatusOK, results)
+}
+
+func (h *Handler) initBatch(cubeInstance cube.Cube) error {
+	route := cubeInstance.GetParam("batchRoute")
+	if route == "" {
+		return nil
+	}
+
+	concurrency, err := getIntParam(cubeInstance, "batchConcurrency")
+	if err != nil {
+		return err
+	}
+
+	if concurrency == 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	maxRequests, err := getIntParam(cubeInstance, "batchMaxRequests")
+	if err != nil {
+		return err
+	}
+
+	if maxRequests == 0 {
+		maxRequests = defaultBatchMaxRequests
+	}
+
+	h.batchRoute = Uri(route)
+	h.batchConcurrency = concurrency
+	h.batchMaxRequests = maxRequests
+	h.addGatewayRoute(h.batchRoute, h.serveBatch)
+	return nil
+}
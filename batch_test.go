@@ -0,0 +1,133 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func serveTestBatch(handler *Handler, body string, prepare func(request *http.Request)) (int, []js.BatchResult) {
+	request := httptest.NewRequest("POST", "http://gateway.test/batch", strings.NewReader(body))
+	if prepare != nil {
+		prepare(request)
+	}
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	var results []js.BatchResult
+	json.Unmarshal(writer.Body.Bytes(), &results)
+
+	return writer.Code, results
+}
+
+func TestBatchRoutesItems(t *testing.T) {
+	handler, _ := newTestHandler(t, map[string]string{
+		"batchRoute":   "/batch",
+		"endpointsMap": "/orders:orders;/users:users",
+	})
+
+	token := newTestToken(t, handler, "user")
+
+	status, results := serveTestBatch(handler, `[
+		{"id": "orders", "method": "POST", "path": "/orders", "body": {"id": 1}},
+		{"path": "/users", "dependsOn": ["orders"]},
+		{"path": "/unknown"}
+	]`, func(request *http.Request) {
+		request.Header.Set("Authorization", "Bearer "+token)
+	})
+
+	if status != http.StatusOK || len(results) != 3 {
+		t.Fatalf("unexpected batch response %v %v", status, results)
+	}
+
+	expected := []struct {
+		id     string
+		status int
+		body   string
+	}{
+		{"orders", http.StatusOK, `"orders"`},
+		{"1", http.StatusOK, `"users"`},
+		{"2", http.StatusBadRequest, ""},
+	}
+
+	for i, result := range results {
+		if result.Id != expected[i].id || result.Status != expected[i].status {
+			t.Errorf("item %v: expected %v %v, got %v %v", i, expected[i].id, expected[i].status, result.Id, result.Status)
+		}
+
+		if expected[i].body != "" && string(result.Body) != expected[i].body {
+			t.Errorf("item %v: expected body %v, got %s", i, expected[i].body, result.Body)
+		}
+	}
+}
+
+func TestBatchRejectsDependencyCycle(t *testing.T) {
+	handler, _ := newTestHandler(t, map[string]string{"batchRoute": "/batch"})
+
+	status, _ := serveTestBatch(handler, `[
+		{"id": "a", "path": "/orders", "dependsOn": ["b"]},
+		{"id": "b", "path": "/orders", "dependsOn": ["a"]}
+	]`, nil)
+
+	if status != http.StatusBadRequest {
+		t.Errorf("expected 400 for dependency cycle, got %v", status)
+	}
+}
+
+func TestBatchRejectsGatewayRoutes(t *testing.T) {
+	handler, _ := newTestHandler(t, map[string]string{"batchRoute": "/batch"})
+
+	for _, path := range []string{"/batch", "/batch?nested=1", "/batch#x"} {
+		_, results := serveTestBatch(handler, `[{"method": "POST", "path": "`+path+`", "body": "[]"}]`, nil)
+
+		if len(results) != 1 || results[0].Status != http.StatusBadRequest {
+			t.Errorf("%v: expected nested batch to be rejected, got %v", path, results)
+		}
+	}
+}
+
+func TestBatchCsrf(t *testing.T) {
+	handler, _ := newTestHandler(t, map[string]string{
+		"batchRoute":   "/batch",
+		"tokenSources": "cookie:access_token",
+		"csrfMode":     "origin",
+	})
+
+	token := newTestToken(t, handler, "user")
+
+	tests := []struct {
+		name        string
+		origin      string
+		itemHeaders string
+		status      int
+		itemStatus  int
+	}{
+		{"same origin", "http://gateway.test", `{}`, http.StatusOK, http.StatusOK},
+		{"cross site", "http://evil.test", `{}`, http.StatusForbidden, 0},
+		{"cross site with item origin", "http://evil.test", `{"Origin": "http://gateway.test"}`, http.StatusForbidden, 0},
+		{"item origin override", "http://gateway.test", `{"origin": "http://gateway.test"}`, http.StatusOK, http.StatusBadRequest},
+		{"item cookie override", "http://gateway.test", `{"Cookie": "access_token=other"}`, http.StatusOK, http.StatusBadRequest},
+		{"item authorization override", "http://gateway.test", `{"Authorization": "Bearer other"}`, http.StatusOK, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		status, results := serveTestBatch(handler, `[{"method": "POST", "path": "/orders", "headers": `+test.itemHeaders+`}]`, func(request *http.Request) {
+			request.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+			request.Header.Set("Origin", test.origin)
+		})
+
+		if status != test.status {
+			t.Errorf("%v: expected batch status %v, got %v", test.name, test.status, status)
+			continue
+		}
+
+		if test.itemStatus != 0 && (len(results) != 1 || results[0].Status != test.itemStatus) {
+			t.Errorf("%v: expected item status %v, got %v", test.name, test.itemStatus, results)
+		}
+	}
+}
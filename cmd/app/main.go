@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/akaumov/cube-executor"
 	"github.com/akaumov/cube-http-gateway"
+	"time"
 )
 
 func main() {
@@ -49,11 +50,389 @@ func main() {
 			EnvVar: "GATEWAY_DEV",
 			Usage:  "log all requests",
 		},
+		cli.BoolFlag{
+			Name:   "access-log",
+			EnvVar: "GATEWAY_ACCESS_LOG",
+			Usage:  "log one line per request with status and protocol",
+		},
 		cli.StringFlag{
 			Name:   "port",
 			EnvVar: "GATEWAY_PORT",
 			Usage:  "port to listen",
 		},
+		cli.StringFlag{
+			Name:   "api-keys-file",
+			EnvVar: "GATEWAY_API_KEYS_FILE",
+			Usage:  "json file with hashed api keys",
+		},
+		cli.StringFlag{
+			Name:   "api-key-tiers",
+			EnvVar: "GATEWAY_API_KEY_TIERS",
+			Usage:  "api key rate limits in format tier:requestsPerMinute;tier:requestsPerMinute",
+		},
+		cli.StringFlag{
+			Name:   "htpasswd-file",
+			EnvVar: "GATEWAY_HTPASSWD_FILE",
+			Usage:  "htpasswd file with bcrypt hashes for basic auth",
+		},
+		cli.StringFlag{
+			Name:   "basic-auth-routes",
+			EnvVar: "GATEWAY_BASIC_AUTH_ROUTES",
+			Usage:  "routes protected by basic auth in format /path;/prefix/*",
+		},
+		cli.StringFlag{
+			Name:   "tls-cert-file",
+			EnvVar: "GATEWAY_TLS_CERT_FILE",
+			Usage:  "tls certificate file, enables https",
+		},
+		cli.StringFlag{
+			Name:   "tls-key-file",
+			EnvVar: "GATEWAY_TLS_KEY_FILE",
+			Usage:  "tls private key file",
+		},
+		cli.StringFlag{
+			Name:   "client-ca-file",
+			EnvVar: "GATEWAY_CLIENT_CA_FILE",
+			Usage:  "ca bundle for client certificates verification",
+		},
+		cli.BoolFlag{
+			Name:   "require-client-cert",
+			EnvVar: "GATEWAY_REQUIRE_CLIENT_CERT",
+			Usage:  "reject tls connections without client certificate",
+		},
+		cli.StringFlag{
+			Name:   "client-cert-routes",
+			EnvVar: "GATEWAY_CLIENT_CERT_ROUTES",
+			Usage:  "identities allowed to call routes in format /path=identity,identity;/prefix/*=spiffe://domain/*",
+		},
+		cli.StringFlag{
+			Name:   "token-sources",
+			EnvVar: "GATEWAY_TOKEN_SOURCES",
+			Usage:  "auth token sources in priority order in format header;cookie:name;query:name",
+		},
+		cli.StringFlag{
+			Name:   "query-token-routes",
+			EnvVar: "GATEWAY_QUERY_TOKEN_ROUTES",
+			Usage:  "routes accepting token from query in format /path;/prefix/*",
+		},
+		cli.StringFlag{
+			Name:   "revocation-snapshot-subject",
+			EnvVar: "GATEWAY_REVOCATION_SNAPSHOT_SUBJECT",
+			Usage:  "subject returning revoked tokens on startup",
+		},
+		cli.StringFlag{
+			Name:   "token-validators",
+			EnvVar: "GATEWAY_TOKEN_VALIDATORS",
+			Usage:  "bearer token validators in priority order in format jwt;delegated;introspection, token not recognized by validator is passed to next one",
+		},
+		cli.StringFlag{
+			Name:   "auth-subject",
+			EnvVar: "GATEWAY_AUTH_SUBJECT",
+			Usage:  "subject verifying opaque tokens for delegated validator",
+		},
+		cli.StringFlag{
+			Name:   "auth-negative-cache-ttl",
+			EnvVar: "GATEWAY_AUTH_NEGATIVE_CACHE_TTL",
+			Usage:  "ms to remember invalid opaque tokens",
+		},
+		cli.StringFlag{
+			Name:   "introspection-url",
+			EnvVar: "GATEWAY_INTROSPECTION_URL",
+			Usage:  "oauth2 token introspection endpoint",
+		},
+		cli.StringFlag{
+			Name:   "introspection-client-id",
+			EnvVar: "GATEWAY_INTROSPECTION_CLIENT_ID",
+			Usage:  "client id for introspection endpoint",
+		},
+		cli.StringFlag{
+			Name:   "introspection-client-secret",
+			EnvVar: "GATEWAY_INTROSPECTION_CLIENT_SECRET",
+			Usage:  "client secret for introspection endpoint",
+		},
+		cli.StringFlag{
+			Name:   "introspection-cache-ttl",
+			EnvVar: "GATEWAY_INTROSPECTION_CACHE_TTL",
+			Usage:  "max ms to cache active introspection results",
+		},
+		cli.StringFlag{
+			Name:   "login-subject",
+			EnvVar: "GATEWAY_LOGIN_SUBJECT",
+			Usage:  "subject verifying credentials for gateway issued tokens",
+		},
+		cli.StringFlag{
+			Name:   "login-route",
+			EnvVar: "GATEWAY_LOGIN_ROUTE",
+			Usage:  "route issuing tokens, /auth/token by default",
+		},
+		cli.StringFlag{
+			Name:   "access-token-lifetime",
+			EnvVar: "GATEWAY_ACCESS_TOKEN_LIFETIME",
+			Usage:  "issued access tokens lifetime ms",
+		},
+		cli.StringFlag{
+			Name:   "refresh-token-store",
+			EnvVar: "GATEWAY_REFRESH_TOKEN_STORE",
+			Usage:  "enables refresh tokens, store in format memory or file:/path/to/tokens.json",
+		},
+		cli.StringFlag{
+			Name:   "refresh-token-lifetime",
+			EnvVar: "GATEWAY_REFRESH_TOKEN_LIFETIME",
+			Usage:  "refresh tokens lifetime ms",
+		},
+		cli.StringFlag{
+			Name:   "auth-events-subject",
+			EnvVar: "GATEWAY_AUTH_EVENTS_SUBJECT",
+			Usage:  "subject for refresh and logout events",
+		},
+		cli.StringFlag{
+			Name:   "hmac-secrets-file",
+			EnvVar: "GATEWAY_HMAC_SECRETS_FILE",
+			Usage:  "json file with secrets of clients signing requests",
+		},
+		cli.StringFlag{
+			Name:   "hmac-replay-window",
+			EnvVar: "GATEWAY_HMAC_REPLAY_WINDOW",
+			Usage:  "ms signed requests are accepted after signing",
+		},
+		cli.StringFlag{
+			Name:   "csrf-mode",
+			EnvVar: "GATEWAY_CSRF_MODE",
+			Usage:  "csrf protection of cookie authenticated requests: doubleSubmit or origin",
+		},
+		cli.StringFlag{
+			Name:   "csrf-cookie",
+			EnvVar: "GATEWAY_CSRF_COOKIE",
+			Usage:  "double submit cookie name, csrf_token by default",
+		},
+		cli.StringFlag{
+			Name:   "csrf-trusted-origins",
+			EnvVar: "GATEWAY_CSRF_TRUSTED_ORIGINS",
+			Usage:  "origins allowed in origin mode in format https://a.com;https://b.com",
+		},
+		cli.StringFlag{
+			Name:   "csrf-exempt-routes",
+			EnvVar: "GATEWAY_CSRF_EXEMPT_ROUTES",
+			Usage:  "routes without csrf check in format /path;/prefix/*",
+		},
+		cli.StringFlag{
+			Name:   "signed-url-secret",
+			EnvVar: "GATEWAY_SIGNED_URL_SECRET",
+			Usage:  "secret for signed expiring urls",
+		},
+		cli.StringFlag{
+			Name:   "session-store",
+			EnvVar: "GATEWAY_SESSION_STORE",
+			Usage:  "enables cookie sessions, store in format memory or file:/path/to/sessions.json",
+		},
+		cli.StringFlag{
+			Name:   "session-ttl",
+			EnvVar: "GATEWAY_SESSION_TTL",
+			Usage:  "ms of inactivity after which session expires",
+		},
+		cli.StringFlag{
+			Name:   "session-cookie",
+			EnvVar: "GATEWAY_SESSION_COOKIE",
+			Usage:  "session cookie name, session_id by default",
+		},
+		cli.StringFlag{
+			Name:   "device-binding",
+			EnvVar: "GATEWAY_DEVICE_BINDING",
+			Usage:  "bind tokens to device fingerprint in format header:X-Device-Fingerprint or clientCert",
+		},
+		cli.StringFlag{
+			Name:   "device-revocation-ttl",
+			EnvVar: "GATEWAY_DEVICE_REVOCATION_TTL",
+			Usage:  "ms tokens of signed out device are rejected",
+		},
+		cli.StringFlag{
+			Name:   "websocket-route",
+			EnvVar: "GATEWAY_WEBSOCKET_ROUTE",
+			Usage:  "route accepting websocket connections, e.g. /ws",
+		},
+		cli.StringFlag{
+			Name:   "websocket-subjects",
+			EnvVar: "GATEWAY_WEBSOCKET_SUBJECTS",
+			Usage:  "subjects websocket clients can send to in format chat.send;events.*",
+		},
+		cli.StringFlag{
+			Name:   "sse-route",
+			EnvVar: "GATEWAY_SSE_ROUTE",
+			Usage:  "route streaming realtime topics as server-sent events, e.g. /events",
+		},
+		cli.StringFlag{
+			Name:   "sse-keep-alive",
+			EnvVar: "GATEWAY_SSE_KEEP_ALIVE",
+			Usage:  "ms between keep-alive comments of event streams",
+		},
+		cli.StringFlag{
+			Name:   "realtime-topics",
+			EnvVar: "GATEWAY_REALTIME_TOPICS",
+			Usage:  "topics in format orders:gateway.events.orders.{userId};news:gateway.events.news",
+		},
+		cli.StringFlag{
+			Name:   "realtime-replay-size",
+			EnvVar: "GATEWAY_REALTIME_REPLAY_SIZE",
+			Usage:  "events kept per topic subject for resume",
+		},
+		cli.StringFlag{
+			Name:   "long-poll-route",
+			EnvVar: "GATEWAY_LONG_POLL_ROUTE",
+			Usage:  "route holding requests until realtime topic events arrive, e.g. /poll",
+		},
+		cli.StringFlag{
+			Name:   "long-poll-timeout",
+			EnvVar: "GATEWAY_LONG_POLL_TIMEOUT",
+			Usage:  "ms long poll request is held without events",
+		},
+		cli.StringFlag{
+			Name:   "tls-certificates",
+			EnvVar: "GATEWAY_TLS_CERTIFICATES",
+			Usage:  "extra certificates chosen by SNI in format cert.pem,key.pem;other-cert.pem,other-key.pem",
+		},
+		cli.StringFlag{
+			Name:   "tls-min-version",
+			EnvVar: "GATEWAY_TLS_MIN_VERSION",
+			Usage:  "minimal tls version: 1.0, 1.1, 1.2 or 1.3, default 1.2",
+		},
+		cli.StringFlag{
+			Name:   "tls-cipher-suites",
+			EnvVar: "GATEWAY_TLS_CIPHER_SUITES",
+			Usage:  "allowed cipher suites in format TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256;TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+		},
+		cli.StringFlag{
+			Name:   "tls-redirect-port",
+			EnvVar: "GATEWAY_TLS_REDIRECT_PORT",
+			Usage:  "port redirecting http requests to https",
+		},
+		cli.StringFlag{
+			Name:   "http2",
+			EnvVar: "GATEWAY_HTTP2",
+			Usage:  "http/2 mode: tls (default), h2c for cleartext http/2 or off",
+		},
+		cli.StringFlag{
+			Name:   "http2-max-concurrent-streams",
+			EnvVar: "GATEWAY_HTTP2_MAX_CONCURRENT_STREAMS",
+			Usage:  "max concurrent http/2 streams per connection",
+		},
+		cli.StringFlag{
+			Name:   "http2-max-read-frame-size",
+			EnvVar: "GATEWAY_HTTP2_MAX_READ_FRAME_SIZE",
+			Usage:  "max http/2 frame size in bytes",
+		},
+		cli.StringFlag{
+			Name:   "http2-max-stream-buffer",
+			EnvVar: "GATEWAY_HTTP2_MAX_STREAM_BUFFER",
+			Usage:  "http/2 receive buffer per stream in bytes",
+		},
+		cli.StringFlag{
+			Name:   "http2-max-connection-buffer",
+			EnvVar: "GATEWAY_HTTP2_MAX_CONNECTION_BUFFER",
+			Usage:  "http/2 receive buffer per connection in bytes",
+		},
+		cli.StringFlag{
+			Name:   "http2-ping-timeout",
+			EnvVar: "GATEWAY_HTTP2_PING_TIMEOUT",
+			Usage:  "ms to wait for http/2 ping response before closing connection",
+		},
+		cli.StringFlag{
+			Name:   "async-routes",
+			EnvVar: "GATEWAY_ASYNC_ROUTES",
+			Usage:  "routes published without waiting for reply in format /events;/analytics/*",
+		},
+		cli.StringFlag{
+			Name:   "job-routes",
+			EnvVar: "GATEWAY_JOB_ROUTES",
+			Usage:  "routes started as long running jobs in format /exports;/reports/*",
+		},
+		cli.StringFlag{
+			Name:   "job-ttl",
+			EnvVar: "GATEWAY_JOB_TTL",
+			Usage:  "ms job state is kept after last update",
+		},
+		cli.StringFlag{
+			Name:   "job-callback-urls",
+			EnvVar: "GATEWAY_JOB_CALLBACK_URLS",
+			Usage:  "allowed X-Callback-Url scheme, host and path prefix in format https://hooks.example.com/jobs;https://other.example.com",
+		},
+		cli.BoolFlag{
+			Name:   "job-push",
+			EnvVar: "GATEWAY_JOB_PUSH",
+			Usage:  "push job completion to user connections",
+		},
+		cli.StringFlag{
+			Name:   "batch-route",
+			EnvVar: "GATEWAY_BATCH_ROUTE",
+			Usage:  "route executing array of sub requests, e.g. /batch",
+		},
+		cli.StringFlag{
+			Name:   "batch-concurrency",
+			EnvVar: "GATEWAY_BATCH_CONCURRENCY",
+			Usage:  "sub requests of batch executed in parallel, default 4",
+		},
+		cli.StringFlag{
+			Name:   "batch-max-requests",
+			EnvVar: "GATEWAY_BATCH_MAX_REQUESTS",
+			Usage:  "max sub requests in batch, default 20",
+		},
+		cli.StringFlag{
+			Name:   "json-rpc-route",
+			EnvVar: "GATEWAY_JSON_RPC_ROUTE",
+			Usage:  "route accepting json-rpc 2.0 calls, e.g. /rpc",
+		},
+		cli.StringFlag{
+			Name:   "json-rpc-methods",
+			EnvVar: "GATEWAY_JSON_RPC_METHODS",
+			Usage:  "allowed json-rpc methods with subjects in format orders.get:orders;users.*:users",
+		},
+		cli.StringFlag{
+			Name:   "webhooks-file",
+			EnvVar: "GATEWAY_WEBHOOKS_FILE",
+			Usage:  "json file with webhook routes, subjects and signature settings",
+		},
+		cli.StringFlag{
+			Name:   "json-rpc-max-batch",
+			EnvVar: "GATEWAY_JSON_RPC_MAX_BATCH",
+			Usage:  "max calls in json-rpc batch, default 20",
+		},
+		cli.StringFlag{
+			Name:   "realtime-buffer-ttl",
+			EnvVar: "GATEWAY_REALTIME_BUFFER_TTL",
+			Usage:  "ms replay buffer of topic subject is kept without events",
+		},
+		cli.StringFlag{
+			Name:   "device-ttl",
+			EnvVar: "GATEWAY_DEVICE_TTL",
+			Usage:  "ms device without requests is kept in device list",
+		},
+	}
+
+	app.Commands = []cli.Command{
+		{
+			Name:   "sign-url",
+			Usage:  "print signed url for GET and HEAD access without login",
+			Action: signUrl,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "signed-url-secret",
+					EnvVar: "GATEWAY_SIGNED_URL_SECRET",
+					Usage:  "secret for signed expiring urls",
+				},
+				cli.StringFlag{
+					Name:  "path",
+					Usage: "url path to sign",
+				},
+				cli.DurationFlag{
+					Name:  "ttl",
+					Value: 24 * time.Hour,
+					Usage: "url lifetime",
+				},
+				cli.StringFlag{
+					Name:  "user-id",
+					Usage: "user id forwarded with requests by url",
+				},
+			},
+		},
 	}
 
 	err := app.Run(os.Args)
@@ -62,6 +441,26 @@ func main() {
 	}
 }
 
+func signUrl(c *cli.Context) error {
+	secret := c.String("signed-url-secret")
+	if secret == "" {
+		return fmt.Errorf("signed url secret is required")
+	}
+
+	path := c.String("path")
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+
+	signedUrl, err := cube_http_gateway.SignUrl(secret, path, time.Now().Add(c.Duration("ttl")), c.String("user-id"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(signedUrl)
+	return nil
+}
+
 func runServer(c *cli.Context) error {
 
 	busHost := c.String("bus-host")
@@ -82,6 +481,88 @@ func runServer(c *cli.Context) error {
 	timeoutMs := c.String("timeout")
 	port := c.String("port")
 	endpointsMap := c.String("endpoints-map")
+	apiKeysFile := c.String("api-keys-file")
+	apiKeyTiers := c.String("api-key-tiers")
+	htpasswdFile := c.String("htpasswd-file")
+	basicAuthRoutes := c.String("basic-auth-routes")
+	tlsCertFile := c.String("tls-cert-file")
+	tlsKeyFile := c.String("tls-key-file")
+	clientCaFile := c.String("client-ca-file")
+	clientCertRoutes := c.String("client-cert-routes")
+	tokenSources := c.String("token-sources")
+	queryTokenRoutes := c.String("query-token-routes")
+	revocationSnapshotSubject := c.String("revocation-snapshot-subject")
+	tokenValidators := c.String("token-validators")
+	authSubject := c.String("auth-subject")
+	authNegativeCacheTtlMs := c.String("auth-negative-cache-ttl")
+	introspectionUrl := c.String("introspection-url")
+	introspectionClientId := c.String("introspection-client-id")
+	introspectionClientSecret := c.String("introspection-client-secret")
+	introspectionCacheTtlMs := c.String("introspection-cache-ttl")
+	loginSubject := c.String("login-subject")
+	loginRoute := c.String("login-route")
+	accessTokenLifetimeMs := c.String("access-token-lifetime")
+	refreshTokenStore := c.String("refresh-token-store")
+	refreshTokenLifetimeMs := c.String("refresh-token-lifetime")
+	authEventsSubject := c.String("auth-events-subject")
+	hmacSecretsFile := c.String("hmac-secrets-file")
+	hmacReplayWindowMs := c.String("hmac-replay-window")
+	csrfMode := c.String("csrf-mode")
+	csrfCookie := c.String("csrf-cookie")
+	csrfTrustedOrigins := c.String("csrf-trusted-origins")
+	csrfExemptRoutes := c.String("csrf-exempt-routes")
+	signedUrlSecret := c.String("signed-url-secret")
+	sessionStore := c.String("session-store")
+	sessionTtlMs := c.String("session-ttl")
+	sessionCookie := c.String("session-cookie")
+	deviceBinding := c.String("device-binding")
+	deviceRevocationTtlMs := c.String("device-revocation-ttl")
+	webSocketRoute := c.String("websocket-route")
+	webSocketSubjects := c.String("websocket-subjects")
+	sseRoute := c.String("sse-route")
+	sseKeepAliveMs := c.String("sse-keep-alive")
+	realtimeTopics := c.String("realtime-topics")
+	realtimeReplaySize := c.String("realtime-replay-size")
+	longPollRoute := c.String("long-poll-route")
+	longPollTimeoutMs := c.String("long-poll-timeout")
+	tlsCertificates := c.String("tls-certificates")
+	tlsMinVersion := c.String("tls-min-version")
+	tlsCipherSuites := c.String("tls-cipher-suites")
+	tlsRedirectPort := c.String("tls-redirect-port")
+	http2 := c.String("http2")
+	http2MaxConcurrentStreams := c.String("http2-max-concurrent-streams")
+	http2MaxReadFrameSize := c.String("http2-max-read-frame-size")
+	http2MaxStreamBuffer := c.String("http2-max-stream-buffer")
+	http2MaxConnectionBuffer := c.String("http2-max-connection-buffer")
+	http2PingTimeoutMs := c.String("http2-ping-timeout")
+	asyncRoutes := c.String("async-routes")
+	jobRoutes := c.String("job-routes")
+	jobTtlMs := c.String("job-ttl")
+	jobCallbackUrls := c.String("job-callback-urls")
+	batchRoute := c.String("batch-route")
+	batchConcurrency := c.String("batch-concurrency")
+	batchMaxRequests := c.String("batch-max-requests")
+	jsonRpcRoute := c.String("json-rpc-route")
+	jsonRpcMethods := c.String("json-rpc-methods")
+	webhooksFile := c.String("webhooks-file")
+	jsonRpcMaxBatch := c.String("json-rpc-max-batch")
+	realtimeBufferTtlMs := c.String("realtime-buffer-ttl")
+	deviceTtlMs := c.String("device-ttl")
+
+	requireClientCert := "false"
+	if c.Bool("require-client-cert") {
+		requireClientCert = "true"
+	}
+
+	accessLog := "false"
+	if c.Bool("access-log") {
+		accessLog = "true"
+	}
+
+	jobPush := "false"
+	if c.Bool("job-push") {
+		jobPush = "true"
+	}
 
 	onlyAuthorizedRequests := "true"
 	if c.Bool("only-authorized-requests") {
@@ -101,12 +582,82 @@ func runServer(c *cli.Context) error {
 		BusPort: busPort,
 		BusHost: busHost,
 		Params: map[string]string{
-			"jwtSecret":              jwtSecret,
-			"timeoutMs":              timeoutMs,
-			"endpointsMap":           endpointsMap,
-			"onlyAuthorizedRequests": onlyAuthorizedRequests,
-			"dev":                    dev,
-			"port":                   port,
+			"jwtSecret":                 jwtSecret,
+			"timeoutMs":                 timeoutMs,
+			"endpointsMap":              endpointsMap,
+			"onlyAuthorizedRequests":    onlyAuthorizedRequests,
+			"dev":                       dev,
+			"port":                      port,
+			"apiKeysFile":               apiKeysFile,
+			"apiKeyTiers":               apiKeyTiers,
+			"htpasswdFile":              htpasswdFile,
+			"basicAuthRoutes":           basicAuthRoutes,
+			"tlsCertFile":               tlsCertFile,
+			"tlsKeyFile":                tlsKeyFile,
+			"clientCaFile":              clientCaFile,
+			"requireClientCert":         requireClientCert,
+			"clientCertRoutes":          clientCertRoutes,
+			"tokenSources":              tokenSources,
+			"queryTokenRoutes":          queryTokenRoutes,
+			"revocationSnapshotSubject": revocationSnapshotSubject,
+			"tokenValidators":           tokenValidators,
+			"authSubject":               authSubject,
+			"authNegativeCacheTtlMs":    authNegativeCacheTtlMs,
+			"introspectionUrl":          introspectionUrl,
+			"introspectionClientId":     introspectionClientId,
+			"introspectionClientSecret": introspectionClientSecret,
+			"introspectionCacheTtlMs":   introspectionCacheTtlMs,
+			"loginSubject":              loginSubject,
+			"loginRoute":                loginRoute,
+			"accessTokenLifetimeMs":     accessTokenLifetimeMs,
+			"refreshTokenStore":         refreshTokenStore,
+			"refreshTokenLifetimeMs":    refreshTokenLifetimeMs,
+			"authEventsSubject":         authEventsSubject,
+			"hmacSecretsFile":           hmacSecretsFile,
+			"hmacReplayWindowMs":        hmacReplayWindowMs,
+			"csrfMode":                  csrfMode,
+			"csrfCookie":                csrfCookie,
+			"csrfTrustedOrigins":        csrfTrustedOrigins,
+			"csrfExemptRoutes":          csrfExemptRoutes,
+			"signedUrlSecret":           signedUrlSecret,
+			"sessionStore":              sessionStore,
+			"sessionTtlMs":              sessionTtlMs,
+			"sessionCookie":             sessionCookie,
+			"deviceBinding":             deviceBinding,
+			"deviceRevocationTtlMs":     deviceRevocationTtlMs,
+			"webSocketRoute":            webSocketRoute,
+			"webSocketSubjects":         webSocketSubjects,
+			"sseRoute":                  sseRoute,
+			"sseKeepAliveMs":            sseKeepAliveMs,
+			"realtimeTopics":            realtimeTopics,
+			"realtimeReplaySize":        realtimeReplaySize,
+			"longPollRoute":             longPollRoute,
+			"longPollTimeoutMs":         longPollTimeoutMs,
+			"tlsCertificates":           tlsCertificates,
+			"tlsMinVersion":             tlsMinVersion,
+			"tlsCipherSuites":           tlsCipherSuites,
+			"tlsRedirectPort":           tlsRedirectPort,
+			"http2":                     http2,
+			"http2MaxConcurrentStreams": http2MaxConcurrentStreams,
+			"http2MaxReadFrameSize":     http2MaxReadFrameSize,
+			"http2MaxStreamBuffer":      http2MaxStreamBuffer,
+			"http2MaxConnectionBuffer":  http2MaxConnectionBuffer,
+			"http2PingTimeoutMs":        http2PingTimeoutMs,
+			"accessLog":                 accessLog,
+			"asyncRoutes":               asyncRoutes,
+			"jobRoutes":                 jobRoutes,
+			"jobTtlMs":                  jobTtlMs,
+			"jobCallbackUrls":           jobCallbackUrls,
+			"jobPush":                   jobPush,
+			"batchRoute":                batchRoute,
+			"batchConcurrency":          batchConcurrency,
+			"batchMaxRequests":          batchMaxRequests,
+			"jsonRpcRoute":              jsonRpcRoute,
+			"jsonRpcMethods":            jsonRpcMethods,
+			"webhooksFile":              webhooksFile,
+			"jsonRpcMaxBatch":           jsonRpcMaxBatch,
+			"realtimeBufferTtlMs":       realtimeBufferTtlMs,
+			"deviceTtlMs":               deviceTtlMs,
 		},
 	}, &cube_http_gateway.Handler{})
 
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+//Local stand-in for OAuth2 introspection endpoint (RFC 7662) to test gateway without authorization server
+
+type tokenInfo struct {
+	Active   bool   `json:"active"`
+	Subject  string `json:"sub,omitempty"`
+	ClientId string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+}
+
+func main() {
+	app := cli.NewApp()
+	app.Usage = "stand-in oauth2 introspection server"
+	app.Action = runServer
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "port",
+			Value: "8090",
+			Usage: "port to listen",
+		},
+		cli.StringFlag{
+			Name:  "tokens",
+			Usage: "active tokens in format token:sub:clientId:scope scope;token:sub:clientId:scope",
+		},
+		cli.StringFlag{
+			Name:  "client-id",
+			Usage: "client id expected in basic auth",
+		},
+		cli.StringFlag{
+			Name:  "client-secret",
+			Usage: "client secret expected in basic auth",
+		},
+		cli.IntFlag{
+			Name:  "lifetime",
+			Value: 3600,
+			Usage: "tokens lifetime in seconds",
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseTokens(rawTokens string, lifetime time.Duration) (map[string]tokenInfo, error) {
+	tokens := map[string]tokenInfo{}
+
+	if rawTokens == "" {
+		return tokens, nil
+	}
+
+	exp := time.Now().Add(lifetime).Unix()
+
+	for _, rawToken := range strings.Split(rawTokens, ";") {
+		splittedToken := strings.Split(rawToken, ":")
+		if len(splittedToken) != 4 {
+			return nil, fmt.Errorf("wrong token format: %v", rawToken)
+		}
+
+		tokens[splittedToken[0]] = tokenInfo{
+			Active:   true,
+			Subject:  splittedToken[1],
+			ClientId: splittedToken[2],
+			Scope:    splittedToken[3],
+			Exp:      exp,
+		}
+	}
+
+	return tokens, nil
+}
+
+func runServer(c *cli.Context) error {
+	tokens, err := parseTokens(c.String("tokens"), time.Duration(c.Int("lifetime"))*time.Second)
+	if err != nil {
+		return err
+	}
+
+	clientId := c.String("client-id")
+	clientSecret := c.String("client-secret")
+
+	http.HandleFunc("/introspect", func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			http.Error(writer, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if clientId != "" {
+			//Client credentials are form-encoded before basic auth encoding (RFC 6749 2.3.1)
+			username, password, ok := request.BasicAuth()
+			if ok {
+				username, _ = url.QueryUnescape(username)
+				password, _ = url.QueryUnescape(password)
+			}
+
+			if !ok || username != clientId || password != clientSecret {
+				http.Error(writer, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		info, ok := tokens[request.PostFormValue("token")]
+		if !ok {
+			info = tokenInfo{Active: false}
+		}
+
+		fmt.Println("introspect:", info.Active, info.Subject)
+
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(info)
+	})
+
+	address := fmt.Sprintf(":%v", c.String("port"))
+	fmt.Println("Listening", address)
+	return http.ListenAndServe(address, nil)
+}
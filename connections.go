@@ -0,0 +1,96 @@
+package cube_http_gateway
+
+import (
+	"sync"
+)
+
+//Live client connection which bus messages can be delivered to
+type liveConnection interface {
+	connectionId() string
+	connectionIdentity() *identity
+	//Returns false if frame can't be delivered
+	send(frame []byte) bool
+	//Ends connection, client has to reconnect with valid credentials
+	close()
+}
+
+//Closed channel of connection served by request handler, it can be closed from any goroutine
+type closeSignal struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newCloseSignal() *closeSignal {
+	return &closeSignal{closed: make(chan struct{})}
+}
+
+func (s *closeSignal) close() {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+}
+
+//Live connections of this gateway instance. Waiting requests don't receive pushes, they are only closed on sign out
+type connectionHub struct {
+	mutex       sync.RWMutex
+	connections map[string]liveConnection
+	waiting     map[string]liveConnection
+}
+
+func newConnectionHub() *connectionHub {
+	return &connectionHub{
+		connections: map[string]liveConnection{},
+		waiting:     map[string]liveConnection{},
+	}
+}
+
+func (hub *connectionHub) add(connection liveConnection) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.connections[connection.connectionId()] = connection
+}
+
+func (hub *connectionHub) remove(connection liveConnection) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	delete(hub.connections, connection.connectionId())
+}
+
+func (hub *connectionHub) addWaiting(connection liveConnection) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.waiting[connection.connectionId()] = connection
+}
+
+func (hub *connectionHub) removeWaiting(connection liveConnection) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	delete(hub.waiting, connection.connectionId())
+}
+
+func (hub *connectionHub) get(connectionId string) liveConnection {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	return hub.connections[connectionId]
+}
+
+//Closes connections of signed out user device
+func (hub *connectionHub) closeDevice(userId string, deviceId string) {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	for _, connections := range []map[string]liveConnection{hub.connections, hub.waiting} {
+		for _, connection := range connections {
+			identity := connection.connectionIdentity()
+
+			if identity.userId != nil && *identity.userId == userId && identity.deviceId != nil && *identity.deviceId == deviceId {
+				connection.close()
+			}
+		}
+	}
+}
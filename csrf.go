@@ -0,0 +1,164 @@
+package cube_http_gateway
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/akaumov/cube"
+)
+
+const (
+	csrfModeDoubleSubmit = "doubleSubmit"
+	csrfModeOrigin       = "origin"
+	csrfHeader           = "X-CSRF-Token"
+	defaultCsrfCookie    = "csrf_token"
+)
+
+type csrfConfig struct {
+	mode           string
+	cookieName     string
+	trustedOrigins []string
+	exemptRoutes   []Uri
+}
+
+func newCsrfConfig(cubeInstance cube.Cube) (*csrfConfig, error) {
+	config := &csrfConfig{
+		mode:         cubeInstance.GetParam("csrfMode"),
+		cookieName:   cubeInstance.GetParam("csrfCookie"),
+		exemptRoutes: parseUriList(cubeInstance.GetParam("csrfExemptRoutes")),
+	}
+
+	if config.mode == "" {
+		config.mode = csrfModeDoubleSubmit
+	}
+
+	if config.mode != csrfModeDoubleSubmit && config.mode != csrfModeOrigin {
+		return nil, fmt.Errorf("Unknown csrf mode: %v\n", config.mode)
+	}
+
+	if config.cookieName == "" {
+		config.cookieName = defaultCsrfCookie
+	}
+
+	rawOrigins := cubeInstance.GetParam("csrfTrustedOrigins")
+	if rawOrigins != "" {
+		config.trustedOrigins = strings.Split(rawOrigins, ";")
+	}
+
+	return config, nil
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func requestOrigin(request *http.Request) string {
+	origin := request.Header.Get("Origin")
+	if origin != "" && origin != "null" {
+		return origin
+	}
+
+	referer, err := url.Parse(request.Header.Get("Referer"))
+	if err != nil || referer.Host == "" {
+		return ""
+	}
+
+	return referer.Scheme + "://" + referer.Host
+}
+
+func (c *csrfConfig) checkOrigin(request *http.Request) error {
+	origin := requestOrigin(request)
+	if origin == "" {
+		return fmt.Errorf("no origin and referer")
+	}
+
+	parsedOrigin, err := url.Parse(origin)
+	if err == nil && parsedOrigin.Host == request.Host {
+		return nil
+	}
+
+	for _, trustedOrigin := range c.trustedOrigins {
+		if origin == trustedOrigin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("untrusted origin %v", origin)
+}
+
+func (c *csrfConfig) checkDoubleSubmit(request *http.Request) error {
+	cookie, err := request.Cookie(c.cookieName)
+	if err != nil || cookie.Value == "" {
+		return fmt.Errorf("no csrf cookie")
+	}
+
+	header := request.Header.Get(csrfHeader)
+	if header == "" {
+		return fmt.Errorf("no csrf header")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+		return fmt.Errorf("csrf header doesn't match cookie")
+	}
+
+	return nil
+}
+
+//Issues double submit cookie readable by browser scripts
+func (c *csrfConfig) ensureCookie(writer http.ResponseWriter, request *http.Request) {
+	cookie, err := request.Cookie(c.cookieName)
+	if err == nil && cookie.Value != "" {
+		return
+	}
+
+	value, err := newRandomToken()
+	if err != nil {
+		return
+	}
+
+	http.SetCookie(writer, &http.Cookie{
+		Name:     c.cookieName,
+		Value:    value,
+		Path:     "/",
+		Secure:   request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+//State changing requests authenticated by cookie must prove they are sent by our pages
+func (h *Handler) checkCsrf(writer http.ResponseWriter, request *http.Request, identity *identity) error {
+	if h.csrf == nil || identity == nil || identity.tokenSource != tokenSourceCookie {
+		return nil
+	}
+
+	if h.csrf.mode == csrfModeDoubleSubmit {
+		h.csrf.ensureCookie(writer, request)
+	}
+
+	if isSafeMethod(request.Method) || matchAnyUri(h.csrf.exemptRoutes, requestPath(request)) {
+		return nil
+	}
+
+	var err error
+	if h.csrf.mode == csrfModeOrigin {
+		err = h.csrf.checkOrigin(request)
+	} else {
+		err = h.csrf.checkDoubleSubmit(request)
+	}
+
+	if err != nil {
+		reason := fmt.Sprintf("CSRF check failed for %v %v from %v: %v", request.Method, request.URL.Path, request.RemoteAddr, err)
+
+		if h.devMode {
+			fmt.Println(reason)
+		}
+
+		h.cubeInstance.LogWarning(reason)
+		return &statusError{status: http.StatusForbidden, reason: reason}
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveCsrfTestRequest(handler *Handler, method string, path string, prepare func(request *http.Request)) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, nil)
+	if prepare != nil {
+		prepare(request)
+	}
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	return writer
+}
+
+func TestCsrfDoubleSubmit(t *testing.T) {
+	handler, _ := newTestHandler(t, map[string]string{
+		"tokenSources":     "cookie:access_token;header",
+		"endpointsMap":     "/orders:orders;/hooks:hooks",
+		"csrfExemptRoutes": "/hooks",
+	})
+
+	token := newTestToken(t, handler, "user")
+
+	withCookies := func(csrfCookie string, csrfHeaderValue string) func(request *http.Request) {
+		return func(request *http.Request) {
+			request.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+
+			if csrfCookie != "" {
+				request.AddCookie(&http.Cookie{Name: defaultCsrfCookie, Value: csrfCookie})
+			}
+
+			if csrfHeaderValue != "" {
+				request.Header.Set(csrfHeader, csrfHeaderValue)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		prepare func(request *http.Request)
+		status  int
+	}{
+		{"safe method", "GET", "/orders", withCookies("", ""), http.StatusOK},
+		{"matching header", "POST", "/orders", withCookies("value", "value"), http.StatusOK},
+		{"missing header", "POST", "/orders", withCookies("value", ""), http.StatusForbidden},
+		{"missing cookie", "POST", "/orders", withCookies("", "value"), http.StatusForbidden},
+		{"mismatched header", "POST", "/orders", withCookies("value", "other"), http.StatusForbidden},
+		{"exempt route", "POST", "/hooks", withCookies("", ""), http.StatusOK},
+		{"bearer token is not checked", "POST", "/orders", func(request *http.Request) {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := serveCsrfTestRequest(handler, test.method, test.path, test.prepare)
+			if writer.Code != test.status {
+				t.Fatalf("expected %v, got %v", test.status, writer.Code)
+			}
+		})
+	}
+
+	writer := serveCsrfTestRequest(handler, "GET", "/orders", withCookies("", ""))
+
+	issued := false
+	for _, cookie := range writer.Result().Cookies() {
+		issued = issued || (cookie.Name == defaultCsrfCookie && cookie.Value != "")
+	}
+
+	if !issued {
+		t.Fatal("expected csrf cookie to be issued to cookie authenticated client")
+	}
+}
+
+func TestCsrfOrigin(t *testing.T) {
+	handler, _ := newTestHandler(t, map[string]string{
+		"tokenSources":       "cookie:access_token",
+		"csrfMode":           "origin",
+		"csrfTrustedOrigins": "https://app.test",
+	})
+
+	token := newTestToken(t, handler, "user")
+
+	tests := []struct {
+		name    string
+		origin  string
+		referer string
+		status  int
+	}{
+		{"same host", "http://example.com", "", http.StatusOK},
+		{"trusted origin", "https://app.test", "", http.StatusOK},
+		{"referer of same host", "", "http://example.com/page", http.StatusOK},
+		{"untrusted origin", "https://evil.test", "", http.StatusForbidden},
+		{"null origin", "null", "", http.StatusForbidden},
+		{"no origin", "", "", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer := serveCsrfTestRequest(handler, "POST", "/orders", func(request *http.Request) {
+				request.AddCookie(&http.Cookie{Name: "access_token", Value: token})
+
+				if test.origin != "" {
+					request.Header.Set("Origin", test.origin)
+				}
+
+				if test.referer != "" {
+					request.Header.Set("Referer", test.referer)
+				}
+			})
+
+			if writer.Code != test.status {
+				t.Fatalf("expected %v, got %v", test.status, writer.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+//Error name auth subject answers with for unknown, malformed or revoked tokens
+const authErrorInvalidToken = "InvalidToken"
+
+var errTokenRejectedByAuthSubject = &tokenRejectedError{reason: "token is rejected by auth subject"}
+
+//Verifies opaque tokens by calling auth subject on the bus
+type delegatedAuth struct {
+	cubeInstance     cube.Cube
+	subject          BusSubject
+	timeout          time.Duration
+	negativeCacheTtl time.Duration
+	cache            *tokenCache
+}
+
+func newDelegatedAuth(cubeInstance cube.Cube, timeout time.Duration) (*delegatedAuth, error) {
+	subject := cubeInstance.GetParam("authSubject")
+	if subject == "" {
+		return nil, fmt.Errorf("auth subject is required for delegated auth")
+	}
+
+	negativeCacheTtl, err := getDurationMsParam(cubeInstance, "authNegativeCacheTtlMs", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delegatedAuth{
+		cubeInstance:     cubeInstance,
+		subject:          BusSubject(subject),
+		timeout:          timeout,
+		negativeCacheTtl: negativeCacheTtl,
+		cache:            newTokenCache(tokenCacheSize),
+	}, nil
+}
+
+func (a *delegatedAuth) validateToken(token string) (*identity, error) {
+	cachedIdentity, ok := a.cache.get(token)
+	if ok {
+		if cachedIdentity == nil {
+			return nil, errTokenRejectedByAuthSubject
+		}
+
+		return cachedIdentity, nil
+	}
+
+	packedParams, err := json.Marshal(js.AuthVerifyParams{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	request := cube.Request{
+		Method: "verify",
+		Params: (*json.RawMessage)(&packedParams),
+	}
+
+	response, err := a.cubeInstance.CallMethod(cube.Channel(a.subject), request, a.timeout)
+	if err != nil {
+		return nil, &statusError{status: http.StatusServiceUnavailable, reason: "auth subject is unavailable: " + err.Error()}
+	}
+
+	//Only definitive rejection is cached, failures of auth cube are retried with next request
+	if response.Error != nil && response.Error.Name == authErrorInvalidToken {
+		a.cache.put(token, nil, time.Now().Add(a.negativeCacheTtl))
+		return nil, errTokenRejectedByAuthSubject
+	}
+
+	if response.Error != nil {
+		return nil, &statusError{status: http.StatusServiceUnavailable, reason: "auth subject failed: " + response.Error.Name}
+	}
+
+	if response.Result == nil {
+		return nil, &statusError{status: http.StatusBadGateway, reason: "auth subject returned no result"}
+	}
+
+	var result js.AuthVerifyResult
+
+	err = json.Unmarshal(*response.Result, &result)
+	if err != nil {
+		return nil, &statusError{status: http.StatusBadGateway, reason: "wrong auth subject response: " + err.Error()}
+	}
+
+	expiresAt := time.Unix(result.ExpiresAt, 0)
+	if !expiresAt.After(time.Now()) {
+		a.cache.put(token, nil, time.Now().Add(a.negativeCacheTtl))
+		return nil, &tokenRejectedError{reason: "token is expired"}
+	}
+
+	identity := &identity{
+		method:   authMethodDelegated,
+		userId:   result.UserId,
+		deviceId: result.DeviceId,
+		clientId: result.ClientId,
+	}
+
+	a.cache.put(token, identity, expiresAt)
+	return identity, nil
+}
@@ -0,0 +1,64 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func TestDelegatedAuthCachesOnlyDefinitiveRejections(t *testing.T) {
+	calls := 0
+	answer := func() (*cube.Response, error) { return nil, nil }
+
+	fake := &fakeCube{
+		params: map[string]string{"authSubject": "auth"},
+		call: func(channel cube.Channel, request cube.Request) (*cube.Response, error) {
+			calls++
+			return answer()
+		},
+	}
+
+	delegatedAuth, err := newDelegatedAuth(fake, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		answer func() (*cube.Response, error)
+		calls  int
+	}{
+		{"bus timeout", func() (*cube.Response, error) { return nil, cube.ErrorTimeout }, 2},
+		{"auth cube failure", func() (*cube.Response, error) {
+			response := cube.NewErrorResponse("", "InternalError", "database is down")
+			return &response, nil
+		}, 2},
+		{"invalid token", func() (*cube.Response, error) {
+			response := cube.NewErrorResponse("", authErrorInvalidToken, "")
+			return &response, nil
+		}, 1},
+		{"valid token", func() (*cube.Response, error) {
+			userId := "user"
+			packedResult, _ := json.Marshal(js.AuthVerifyResult{UserId: &userId, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+			response := cube.NewResultResponse("", (*json.RawMessage)(&packedResult))
+			return &response, nil
+		}, 1},
+	}
+
+	for i, test := range tests {
+		calls = 0
+		answer = test.answer
+		token := fmt.Sprint("token", i)
+
+		delegatedAuth.validateToken(token)
+		delegatedAuth.validateToken(token)
+
+		if calls != test.calls {
+			t.Errorf("%v: expected %v calls to auth subject, got %v", test.name, test.calls, calls)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package cube_http_gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	DevicesChannel = "gateway.devices"
+
+	deviceFingerprintClaim  = "deviceFingerprint"
+	deviceBindingClientCert = "clientCert"
+
+	deviceMethodSeen    = "seen"
+	deviceMethodSignOut = "signOut"
+	deviceMethodList    = "list"
+
+	defaultDeviceTtl = 30 * 24 * time.Hour
+	//Seen device is announced again after this time so other instances don't prune it
+	deviceSeenInterval = int64(time.Hour / time.Second)
+)
+
+//Active devices of users, kept in sync between gateway instances over the bus.
+//Device is forgotten after ttl without requests
+type deviceRegistry struct {
+	mutex sync.RWMutex
+	ttl   time.Duration
+	users map[string]map[string]js.Device
+}
+
+func newDeviceRegistry(stop <-chan struct{}) *deviceRegistry {
+	registry := &deviceRegistry{
+		ttl:   defaultDeviceTtl,
+		users: map[string]map[string]js.Device{},
+	}
+
+	go runEvery(time.Hour, registry.prune, stop)
+	return registry
+}
+
+func (r *deviceRegistry) setTtl(ttl time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ttl = ttl
+}
+
+func (r *deviceRegistry) prune() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	seenAfter := time.Now().Add(-r.ttl).Unix()
+
+	for userId, devices := range r.users {
+		for deviceId, device := range devices {
+			if device.LastSeen < seenAfter {
+				delete(devices, deviceId)
+			}
+		}
+
+		if len(devices) == 0 {
+			delete(r.users, userId)
+		}
+	}
+}
+
+//Returns true if device is not known yet or was not announced for deviceSeenInterval
+func (r *deviceRegistry) touch(userId string, device js.Device) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	devices := r.users[userId]
+	if devices == nil {
+		devices = map[string]js.Device{}
+		r.users[userId] = devices
+	}
+
+	knownDevice, known := devices[device.DeviceId]
+	if known && knownDevice.LastSeen >= device.LastSeen-deviceSeenInterval {
+		return false
+	}
+
+	devices[device.DeviceId] = device
+	return true
+}
+
+func (r *deviceRegistry) remove(userId string, deviceId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	devices := r.users[userId]
+	delete(devices, deviceId)
+
+	if len(devices) == 0 {
+		delete(r.users, userId)
+	}
+}
+
+func (r *deviceRegistry) list(userId string) []js.Device {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	devices := []js.Device{}
+	for _, device := range r.users[userId] {
+		devices = append(devices, device)
+	}
+
+	return devices
+}
+
+func hashFingerprint(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
+//Returns hash of device fingerprint presented with request, empty if there is no fingerprint
+func (h *Handler) requestDeviceFingerprint(request *http.Request) string {
+	if h.deviceBinding == deviceBindingClientCert {
+		certificate := clientCertificate(request)
+		if certificate == nil {
+			return ""
+		}
+
+		return hashFingerprint(certificate.Raw)
+	}
+
+	value := request.Header.Get(h.deviceBinding)
+	if value == "" {
+		return ""
+	}
+
+	return hashFingerprint([]byte(value))
+}
+
+//Token bound to device is accepted only with the same device fingerprint
+func (h *Handler) checkDeviceBinding(request *http.Request, identity *identity) error {
+	if h.deviceBinding == "" || identity.method != authMethodJwt {
+		return nil
+	}
+
+	fingerprint := h.requestDeviceFingerprint(request)
+
+	if identity.deviceFingerprint == "" || fingerprint == "" || identity.deviceFingerprint != fingerprint {
+		return fmt.Errorf("token is bound to another device")
+	}
+
+	return nil
+}
+
+//Registers device of authenticated request and notifies other instances about new device
+func (h *Handler) trackDevice(request *http.Request, identity *identity) {
+	if identity == nil || identity.userId == nil || identity.deviceId == nil {
+		return
+	}
+
+	device := js.Device{
+		DeviceId:  *identity.deviceId,
+		UserAgent: request.UserAgent(),
+		LastSeen:  time.Now().Unix(),
+	}
+
+	if !h.devices.touch(*identity.userId, device) {
+		return
+	}
+
+	packedParams, err := json.Marshal(js.DeviceMessage{
+		UserId: *identity.userId,
+		Device: device,
+	})
+
+	if err != nil {
+		return
+	}
+
+	err = h.cubeInstance.PublishMessage(DevicesChannel, cube.Message{
+		Id:     uuid.NewV4().String(),
+		Method: deviceMethodSeen,
+		Params: (*json.RawMessage)(&packedParams),
+	})
+
+	if err != nil {
+		h.cubeInstance.LogError("Can't publish device: " + err.Error())
+	}
+}
+
+//Sign out message reaches every gateway instance, each one drops its own state of device
+func (h *Handler) signOutDevice(userId string, deviceId string) {
+	h.devices.remove(userId, deviceId)
+
+	now := time.Now()
+
+	//Device ids are chosen by clients, so revocation is scoped to user
+	h.revocations.add([]js.Revocation{{
+		UserId:       &userId,
+		DeviceId:     &deviceId,
+		IssuedBefore: now.Unix() + 1,
+		ExpiresAt:    now.Add(h.deviceRevocationTtl).Unix(),
+	}})
+
+	if h.refreshTokens != nil {
+		err := h.refreshTokens.revokeDevice(userId, deviceId)
+		if err != nil {
+			h.cubeInstance.LogError("Can't revoke device refresh tokens: " + err.Error())
+		}
+	}
+
+	if h.sessions != nil {
+		err := h.sessions.deleteDevice(userId, deviceId)
+		if err != nil {
+			h.cubeInstance.LogError("Can't delete device sessions: " + err.Error())
+		}
+	}
+
+	h.connections.closeDevice(userId, deviceId)
+}
+
+func (h *Handler) onDeviceMessage(instance cube.Cube, message cube.Message) {
+	if message.Params == nil {
+		return
+	}
+
+	var params js.DeviceMessage
+
+	err := json.Unmarshal(*message.Params, &params)
+	if err != nil || params.UserId == "" || params.Device.DeviceId == "" {
+		instance.LogError("Wrong device message")
+		return
+	}
+
+	switch message.Method {
+	case deviceMethodSeen:
+		h.devices.touch(params.UserId, params.Device)
+	case deviceMethodSignOut:
+		h.signOutDevice(params.UserId, params.Device.DeviceId)
+	default:
+		instance.LogError("Unknown device message: " + message.Method)
+	}
+}
+
+func (h *Handler) onDevicesRequest(request cube.Request) cube.Response {
+	if request.Method != deviceMethodList || request.Params == nil {
+		return cube.NewErrorResponse("", "WrongParams", "list method with userId is expected")
+	}
+
+	var params js.DeviceMessage
+
+	err := json.Unmarshal(*request.Params, &params)
+	if err != nil || params.UserId == "" {
+		return cube.NewErrorResponse("", "WrongParams", "userId is required")
+	}
+
+	packedResult, err := json.Marshal(h.devices.list(params.UserId))
+	if err != nil {
+		return cube.NewErrorResponse("", "InternalError", err.Error())
+	}
+
+	return cube.NewResultResponse("", (*json.RawMessage)(&packedResult))
+}
+
+//Format: "header:X-Device-Fingerprint" or "clientCert"
+func (h *Handler) initDeviceBinding(cubeInstance cube.Cube) error {
+	rawBinding := cubeInstance.GetParam("deviceBinding")
+
+	switch {
+	case rawBinding == "":
+	case rawBinding == deviceBindingClientCert:
+		if h.tlsConfig == nil || h.tlsConfig.ClientCAs == nil {
+			return fmt.Errorf("client cert device binding requires tls and client ca file")
+		}
+
+		h.deviceBinding = deviceBindingClientCert
+	case strings.HasPrefix(rawBinding, "header:") && len(rawBinding) > len("header:"):
+		h.deviceBinding = strings.TrimPrefix(rawBinding, "header:")
+	default:
+		return fmt.Errorf("Wrong device binding: %v\n", rawBinding)
+	}
+
+	var err error
+
+	h.deviceRevocationTtl, err = getDurationMsParam(cubeInstance, "deviceRevocationTtlMs", 30*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	deviceTtl, err := getDurationMsParam(cubeInstance, "deviceTtlMs", defaultDeviceTtl)
+	if err != nil {
+		return err
+	}
+
+	h.devices.setTtl(deviceTtl)
+	return nil
+}
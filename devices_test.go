@@ -0,0 +1,107 @@
+package cube_http_gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func TestSignOutDeviceIsScopedToUser(t *testing.T) {
+	handler, _ := newTestHandler(t, nil)
+
+	issuedAt := time.Now().Unix()
+	handler.signOutDevice("first", "phone")
+
+	if !handler.revocations.isRevoked("", "first", "phone", issuedAt) {
+		t.Fatal("expected device of user to be revoked")
+	}
+
+	if handler.revocations.isRevoked("", "second", "phone", issuedAt) {
+		t.Fatal("expected device with the same id of other user to stay valid")
+	}
+
+	if handler.revocations.isRevoked("", "first", "laptop", issuedAt) {
+		t.Fatal("expected other device of user to stay valid")
+	}
+}
+
+func TestDeviceRegistryPrunesInactiveDevices(t *testing.T) {
+	registry := newDeviceRegistry(newTestStop(t))
+	registry.setTtl(time.Hour)
+
+	now := time.Now()
+
+	registry.touch("user", js.Device{DeviceId: "old", LastSeen: now.Add(-2 * time.Hour).Unix()})
+	registry.touch("user", js.Device{DeviceId: "active", LastSeen: now.Unix()})
+	registry.touch("gone", js.Device{DeviceId: "old", LastSeen: now.Add(-2 * time.Hour).Unix()})
+
+	registry.prune()
+
+	devices := registry.list("user")
+	if len(devices) != 1 || devices[0].DeviceId != "active" {
+		t.Fatalf("expected only active device, got %v", devices)
+	}
+
+	if _, ok := registry.users["gone"]; ok {
+		t.Fatal("expected user without devices to be removed")
+	}
+}
+
+func TestSignOutDeviceDeletesSessionsAndClosesConnections(t *testing.T) {
+	handler, _ := newTestHandler(t, nil)
+	handler.sessions = newMemorySessionStore(newTestStop(t))
+
+	userId := "user"
+	deviceId := "phone"
+	otherDeviceId := "laptop"
+
+	handler.sessions.save(session{Hash: "phone", UserId: userId, DeviceId: deviceId, ExpiresAt: time.Now().Add(time.Hour)})
+	handler.sessions.save(session{Hash: "laptop", UserId: userId, DeviceId: otherDeviceId, ExpiresAt: time.Now().Add(time.Hour)})
+
+	phone := &sseConnection{
+		closeSignal: newCloseSignal(),
+		id:          "phone",
+		identity:    &identity{userId: &userId, deviceId: &deviceId},
+	}
+
+	laptop := &sseConnection{
+		closeSignal: newCloseSignal(),
+		id:          "laptop",
+		identity:    &identity{userId: &userId, deviceId: &otherDeviceId},
+	}
+
+	waitingPhone := &longPollConnection{
+		closeSignal: newCloseSignal(),
+		id:          "waiting-phone",
+		identity:    &identity{userId: &userId, deviceId: &deviceId},
+	}
+
+	handler.connections.add(phone)
+	handler.connections.add(laptop)
+	handler.connections.addWaiting(waitingPhone)
+
+	handler.signOutDevice(userId, deviceId)
+
+	if stored, _ := handler.sessions.get("phone"); stored != nil {
+		t.Fatal("expected session of signed out device to be deleted")
+	}
+
+	if stored, _ := handler.sessions.get("laptop"); stored == nil {
+		t.Fatal("expected session of other device to be kept")
+	}
+
+	for _, signal := range []*closeSignal{phone.closeSignal, waitingPhone.closeSignal} {
+		select {
+		case <-signal.closed:
+		default:
+			t.Fatal("expected connection of signed out device to be closed")
+		}
+	}
+
+	select {
+	case <-laptop.closed:
+		t.Fatal("expected connection of other device to stay open")
+	default:
+	}
+}
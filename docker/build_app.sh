@@ -7,4 +7,4 @@ DIR_RELATIVE_PATH="$( dirname "$( which "$0" )" )"
 DIR_ABSOLUTE_PATH="$(pwd)/$(basename "$DIR_RELATIVE_PATH")"
 mkdir "$DIR_ABSOLUTE_PATH"/build -p
 
-docker run --rm -v "$PWD":/go/src/"$APP_PATH" -v "$DIR_ABSOLUTE_PATH"/build:/build -w /go/src/"$APP_PATH"/cmd/app golang:1.10.3-alpine go build -x -v -o /build/app
\ No newline at end of file
+docker run --rm -v "$PWD":/go/src/"$APP_PATH" -v "$DIR_ABSOLUTE_PATH"/build:/build -w /go/src/"$APP_PATH"/cmd/app -e GO111MODULE=off golang:1.24-alpine go build -x -v -o /build/app
\ No newline at end of file
@@ -0,0 +1,78 @@
+package cube_http_gateway
+
+import (
+	"sync"
+	"time"
+)
+
+//Calls fn every interval until stop is closed
+func runEvery(interval time.Duration, fn func(), stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fn()
+		case <-stop:
+			return
+		}
+	}
+}
+
+//Keys remembered until expiry, expired keys are pruned in background so add stays O(1)
+type expiringSet struct {
+	mutex sync.Mutex
+	keys  map[string]time.Time
+}
+
+func newExpiringSet(pruneInterval time.Duration, stop <-chan struct{}) *expiringSet {
+	set := &expiringSet{
+		keys: map[string]time.Time{},
+	}
+
+	go runEvery(pruneInterval, set.prune, stop)
+	return set
+}
+
+//Returns false if key is already remembered
+func (set *expiringSet) add(key string, expiresAt time.Time) bool {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	storedExpiresAt, ok := set.keys[key]
+	if ok && time.Now().Before(storedExpiresAt) {
+		return false
+	}
+
+	set.keys[key] = expiresAt
+	return true
+}
+
+func (set *expiringSet) contains(key string) bool {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	expiresAt, ok := set.keys[key]
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (set *expiringSet) remove(key string) {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	delete(set.keys, key)
+}
+
+func (set *expiringSet) prune() {
+	set.mutex.Lock()
+	defer set.mutex.Unlock()
+
+	now := time.Now()
+
+	for key, expiresAt := range set.keys {
+		if now.After(expiresAt) {
+			delete(set.keys, key)
+		}
+	}
+}
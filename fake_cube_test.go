@@ -0,0 +1,133 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+//Cube replacing bus in tests, calls are answered by call func
+type fakeCube struct {
+	mutex     sync.Mutex
+	params    map[string]string
+	published []cube.Message
+	channels  []cube.Channel
+	call      func(channel cube.Channel, request cube.Request) (*cube.Response, error)
+
+	//Returned by PublishMessage when set, only for publishErrChannel if it is set too
+	publishErr        error
+	publishErrChannel cube.Channel
+}
+
+func (c *fakeCube) GetParam(name string) string  { return c.params[name] }
+func (c *fakeCube) GetClass() string             { return "" }
+func (c *fakeCube) GetInstanceId() string        { return "test" }
+func (c *fakeCube) Stop()                        {}
+func (c *fakeCube) LogDebug(text string) error   { return nil }
+func (c *fakeCube) LogError(text string) error   { return nil }
+func (c *fakeCube) LogFatal(text string) error   { return nil }
+func (c *fakeCube) LogInfo(text string) error    { return nil }
+func (c *fakeCube) LogWarning(text string) error { return nil }
+func (c *fakeCube) LogTrace(text string) error   { return nil }
+
+func (c *fakeCube) PublishMessage(channel cube.Channel, message cube.Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.publishErr != nil && (c.publishErrChannel == "" || c.publishErrChannel == channel) {
+		return c.publishErr
+	}
+
+	c.published = append(c.published, message)
+	c.channels = append(c.channels, channel)
+	return nil
+}
+
+func (c *fakeCube) CallMethod(channel cube.Channel, request cube.Request, timeout time.Duration) (*cube.Response, error) {
+	return c.call(channel, request)
+}
+
+func (c *fakeCube) publishedMessages(channel cube.Channel) []cube.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	messages := []cube.Message{}
+	for i := range c.channels {
+		if c.channels[i] == channel {
+			messages = append(messages, c.published[i])
+		}
+	}
+
+	return messages
+}
+
+func (c *fakeCube) publishedChannels() []cube.Channel {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]cube.Channel{}, c.channels...)
+}
+
+//Answers every call with 200 and channel name as body
+func echoChannelCall(channel cube.Channel, request cube.Request) (*cube.Response, error) {
+	packedResponse, err := json.Marshal(js.Response{
+		Status: 200,
+		Body:   []byte(channel),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := cube.NewResultResponse("", (*json.RawMessage)(&packedResponse))
+	return &response, nil
+}
+
+func newTestHandler(t *testing.T, params map[string]string) (*Handler, *fakeCube) {
+	allParams := map[string]string{
+		"port":         "0",
+		"jwtSecret":    "test-secret",
+		"endpointsMap": "/orders:orders",
+	}
+
+	for name, value := range params {
+		allParams[name] = value
+	}
+
+	fake := &fakeCube{
+		params: allParams,
+		call:   echoChannelCall,
+	}
+
+	handler := &Handler{}
+	handler.OnInitInstance()
+	t.Cleanup(func() { handler.OnStop(fake) })
+
+	err := handler.OnStart(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler.accessTokenLifetime = time.Hour
+	return handler, fake
+}
+
+//Stop channel closed when test ends
+func newTestStop(t *testing.T) <-chan struct{} {
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	return stop
+}
+
+func newTestToken(t *testing.T, handler *Handler, userId string) string {
+	token, _, err := handler.signAccessToken(userId, "device-"+userId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
@@ -0,0 +1,26 @@
+package cube_http_gateway
+
+import (
+	"os"
+	"time"
+)
+
+//Polls file modification time and calls onChange when file is changed, until stop is closed
+func watchFile(path string, interval time.Duration, onChange func(), stop <-chan struct{}) {
+	lastModTime := time.Time{}
+
+	info, err := os.Stat(path)
+	if err == nil {
+		lastModTime = info.ModTime()
+	}
+
+	runEvery(interval, func() {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(lastModTime) {
+			return
+		}
+
+		lastModTime = info.ModTime()
+		onChange()
+	}, stop)
+}
@@ -1,10 +1,11 @@
 package cube_http_gateway
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"github.com/SermoDigital/jose/crypto"
-	"github.com/SermoDigital/jose/jws"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/jws"
 	"github.com/akaumov/cube"
 	"github.com/akaumov/cube-http-gateway/js"
 	"io/ioutil"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"time"
 	"strings"
+	"sync"
 )
 
 const Version = "1"
@@ -21,6 +23,9 @@ type Uri string
 
 type Handler struct {
 	httpServer             *http.Server
+	redirectServer         *http.Server
+	stop                   chan struct{}
+	stopOnce               sync.Once
 	cubeInstance           cube.Cube
 	timeoutMs              uint64
 	onlyAuthorizedRequests bool
@@ -28,6 +33,45 @@ type Handler struct {
 	endpointsMap           map[Uri]BusSubject
 	devMode                bool
 	port                   int
+	tlsConfig              *tls.Config
+	tlsRedirectPort        string
+	authenticators         []authenticator
+	tokenSources           []tokenSource
+	queryTokenRoutes       []Uri
+	revocations            *revocationList
+	gatewayRoutes          []gatewayRoute
+	loginSubject           BusSubject
+	accessTokenLifetime    time.Duration
+	refreshTokens          refreshTokenStore
+	sessions               sessionStore
+	refreshTokenLifetime   time.Duration
+	authEventsSubject      BusSubject
+	csrf                   *csrfConfig
+	signedUrlSecret        string
+	deviceBinding          string
+	deviceRevocationTtl    time.Duration
+	devices                *deviceRegistry
+	connections            *connectionHub
+	webSocketSubjects      []BusSubject
+	realtimeTopics         map[string]BusSubject
+	topics                 *topicHub
+	sseKeepAlive           time.Duration
+	longPollTimeout        time.Duration
+	httpProtocols          *http.Protocols
+	http2Config            *http.HTTP2Config
+	accessLog              bool
+	asyncRoutes            []Uri
+	jobRoutes              []Uri
+	jobCallbackUrls        []callbackUrl
+	jobPush                bool
+	jobs                   *jobStore
+	batchRoute             Uri
+	batchConcurrency       int
+	batchMaxRequests       int
+	jsonRpcMethods         []jsonRpcMethod
+	jsonRpcMaxBatch        int
+	webhookDeliveries      *expiringSet
+	webhookInFlight        *expiringSet
 }
 
 func parseEndpointsMap(rawMap string) (*map[Uri]BusSubject, error) {
@@ -53,8 +97,37 @@ func parseEndpointsMap(rawMap string) (*map[Uri]BusSubject, error) {
 	return &params, nil
 }
 
+func getDurationMsParam(cubeInstance cube.Cube, name string, defaultValue time.Duration) (time.Duration, error) {
+	rawValue := cubeInstance.GetParam(name)
+	if rawValue == "" {
+		return defaultValue, nil
+	}
+
+	ms, err := strconv.ParseUint(rawValue, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Wrong %v: %v\n", name, rawValue)
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
 func (h *Handler) OnInitInstance() []cube.InputChannel {
-	return []cube.InputChannel{}
+	h.stop = make(chan struct{})
+	h.revocations = newRevocationList(h.stop)
+	h.devices = newDeviceRegistry(h.stop)
+	h.connections = newConnectionHub()
+	h.topics = newTopicHub(defaultReplaySize, h.stop)
+	h.jobs = newJobStore(h.stop)
+
+	return []cube.InputChannel{
+		RevocationsChannel,
+		SignUrlChannel,
+		DevicesChannel,
+		WebSocketChannel,
+		PushChannel,
+		RealtimeChannel,
+		JobsChannel,
+	}
 }
 
 func (h *Handler) OnStart(cubeInstance cube.Cube) error {
@@ -62,6 +135,7 @@ func (h *Handler) OnStart(cubeInstance cube.Cube) error {
 
 	h.cubeInstance = cubeInstance
 	h.jwtSecret = cubeInstance.GetParam("jwtSecret")
+	h.signedUrlSecret = cubeInstance.GetParam("signedUrlSecret")
 	h.onlyAuthorizedRequests = cubeInstance.GetParam("onlyAuthorizedRequests") == "true"
 	h.devMode = cubeInstance.GetParam("dev") == "true"
 
@@ -100,22 +174,159 @@ func (h *Handler) OnStart(cubeInstance cube.Cube) error {
 
 	h.endpointsMap = *endpointsMap
 
+	err = h.initTls(cubeInstance)
+	if err != nil {
+		cubeInstance.LogError("Wrong tls config")
+		return err
+	}
+
+	err = h.initHttp2(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	h.accessLog = cubeInstance.GetParam("accessLog") == "true"
+	h.asyncRoutes = parseUriList(cubeInstance.GetParam("asyncRoutes"))
+
+	err = h.initDeviceBinding(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	h.gatewayRoutes = []gatewayRoute{}
+
+	h.loginSubject = BusSubject(cubeInstance.GetParam("loginSubject"))
+	if h.loginSubject != "" {
+		if h.jwtSecret == "" {
+			return fmt.Errorf("jwt secret is required for login subject")
+		}
+
+		h.accessTokenLifetime, err = getDurationMsParam(cubeInstance, "accessTokenLifetimeMs", time.Hour)
+		if err != nil {
+			return err
+		}
+
+		loginRoute := cubeInstance.GetParam("loginRoute")
+		if loginRoute == "" {
+			loginRoute = defaultLoginRoute
+		}
+
+		h.addGatewayRoute(Uri(loginRoute), h.serveLogin)
+
+		err = h.initRefreshTokens(cubeInstance)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = h.initAuthenticators(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	h.initWebSocket(cubeInstance)
+
+	err = h.initRealtime(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	err = h.initSse(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	err = h.initLongPoll(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	err = h.initJobs(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	err = h.initBatch(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	err = h.initJsonRpc(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	err = h.initWebhooks(cubeInstance)
+	if err != nil {
+		return err
+	}
+
+	h.httpServer = &http.Server{
+		Addr:      fmt.Sprintf(":%v", h.port),
+		Handler:   h,
+		TLSConfig: h.tlsConfig,
+		Protocols: h.httpProtocols,
+		HTTP2:     h.http2Config,
+	}
+
+	if h.tlsConfig != nil && h.tlsRedirectPort != "" {
+		h.redirectServer = h.newRedirectServer()
+	}
+
 	go h.startHttpServer(cubeInstance)
+
+	h.initRevocations(cubeInstance)
 	return nil
 }
 
 func (h *Handler) OnStop(c cube.Cube) {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+
+		if h.httpServer != nil {
+			h.httpServer.Close()
+		}
+
+		if h.redirectServer != nil {
+			h.redirectServer.Close()
+		}
+	})
 }
 
 func (h *Handler) OnReceiveMessage(instance cube.Cube, channel cube.Channel, message cube.Message) {
-	fmt.Println("OnReceiveMessage: is not implemented")
-	instance.LogError("OnReceiveMessage: is not implemented")
+	switch channel {
+	case RevocationsChannel:
+		h.onRevocationMessage(instance, message)
+	case DevicesChannel:
+		h.onDeviceMessage(instance, message)
+	case WebSocketChannel:
+		h.onWebSocketMessage(instance, message)
+	case PushChannel:
+		h.onPushMessage(instance, message)
+	case JobsChannel:
+		h.onJobMessage(instance, message)
+	default:
+		if strings.HasPrefix(string(channel), realtimeSubjectPrefix) {
+			h.onRealtimeMessage(instance, channel, message)
+			return
+		}
+
+		fmt.Println("OnReceiveMessage: unknown channel", channel)
+		instance.LogError("OnReceiveMessage: unknown channel " + string(channel))
+	}
 }
 
 //From bus
 func (h *Handler) OnReceiveRequest(instance cube.Cube, channel cube.Channel, request cube.Request) cube.Response {
-	fmt.Println("OnReceiveRequest: is not implemented")
-	instance.LogError("OnReceiveRequest: is not implemented")
+	switch channel {
+	case SignUrlChannel:
+		return h.onSignUrlRequest(request)
+	case DevicesChannel:
+		return h.onDevicesRequest(request)
+	}
+
+	fmt.Println("OnReceiveRequest: unknown channel", channel)
+	instance.LogError("OnReceiveRequest: unknown channel " + string(channel))
 	return cube.NewErrorResponse(
 		"",
 		"NotImplemented",
@@ -125,49 +336,74 @@ func (h *Handler) OnReceiveRequest(instance cube.Cube, channel cube.Channel, req
 
 func (h *Handler) startHttpServer(cubeInstance cube.Cube) {
 
-	srv := http.Server{
-		Addr:    ":80",
-		Handler: h,
-	}
-
-	h.httpServer = &srv
-
 	fmt.Println("Start http listening")
 	cubeInstance.LogInfo("Start http listening")
 
-	address := fmt.Sprintf(":%v", h.port)
+	var err error
+	if h.tlsConfig != nil {
+		if h.redirectServer != nil {
+			go h.startRedirectServer(cubeInstance)
+		}
 
-	http.HandleFunc("/", h.ServeHTTP)
-	err := http.ListenAndServe(address, nil)
+		err = h.httpServer.ListenAndServeTLS("", "")
+	} else {
+		err = h.httpServer.ListenAndServe()
+	}
 
 	fmt.Println("Stop http listenning", err)
-	cubeInstance.LogFatal(err.Error())
+
+	if err != http.ErrServerClosed {
+		cubeInstance.LogFatal(err.Error())
+	}
 }
 
-func (h *Handler) getAuthData(tokenString string) (*string, *string, error) {
+func (h *Handler) getAuthData(tokenString string) (*identity, error) {
 
 	if tokenString == "" {
-		return nil, nil, fmt.Errorf("empty token")
+		return nil, fmt.Errorf("empty token")
 	}
 
 	newToken, err := jws.ParseJWT([]byte(tokenString))
 	if err != nil {
-		return nil, nil, err
+		return nil, errTokenNotRecognized
 	}
 
+	//Token signed by other issuer may be accepted by next validator, claims errors are final
 	err = newToken.Validate([]byte(h.jwtSecret), crypto.SigningMethodHS512)
+	if err == jws.ErrMismatchedAlgorithms || err == crypto.ErrSignatureInvalid {
+		return nil, errTokenNotRecognized
+	}
+
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	claims := newToken.Claims()
 	userId := claims.Get("userId").(string)
 	deviceId := claims.Get("deviceId").(string)
 
-	return &userId, &deviceId, nil
+	jti, _ := claims.JWTID()
+	issuedAt, _ := claims.IssuedAt()
+
+	if !h.revocations.isLoaded() {
+		return nil, &statusError{status: http.StatusServiceUnavailable, reason: "revocations are not loaded"}
+	}
+
+	if h.revocations.isRevoked(jti, userId, deviceId, issuedAt.Unix()) {
+		return nil, fmt.Errorf("token is revoked")
+	}
+
+	deviceFingerprint, _ := claims.Get(deviceFingerprintClaim).(string)
+
+	return &identity{
+		method:            authMethodJwt,
+		userId:            &userId,
+		deviceId:          &deviceId,
+		deviceFingerprint: deviceFingerprint,
+	}, nil
 }
 
-func (h *Handler) packRequest(userId *string, deviceId *string, request *http.Request) (*cube.Request, error) {
+func (h *Handler) packRequest(identity *identity, request *http.Request) (*cube.Request, error) {
 	var err error
 	var body []byte
 
@@ -190,8 +426,6 @@ func (h *Handler) packRequest(userId *string, deviceId *string, request *http.Re
 	}
 
 	params := js.RequestParams{
-		DeviceId:   deviceId,
-		UserId:     userId,
 		Method:     request.Method,
 		InputTime:  time.Now().UnixNano(),
 		Host:       request.Host,
@@ -199,8 +433,20 @@ func (h *Handler) packRequest(userId *string, deviceId *string, request *http.Re
 		Body:       body,
 		RemoteAddr: request.RemoteAddr,
 		Headers:    headers,
+		Protocol:   request.Proto,
 	}
 
+	if identity != nil {
+		params.AuthMethod = identity.method
+		params.UserId = identity.userId
+		params.DeviceId = identity.deviceId
+		params.ClientId = identity.clientId
+		params.ApiKeyId = identity.apiKeyId
+		params.Scopes = identity.scopes
+	}
+
+	params.ClientCertificate = packClientCertificate(request)
+
 	packedParams, err := json.Marshal(params)
 
 	requestData := &cube.Request{
@@ -261,6 +507,15 @@ func (h *Handler) handleResponse(responseMessage *cube.Response, writer http.Res
 //Request from gateway
 func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 
+	h.stripQueryTokens(request)
+
+	if h.accessLog {
+		accessLogWriter := &accessLogWriter{ResponseWriter: writer}
+		defer h.logAccess(accessLogWriter, request, time.Now())
+
+		writer = accessLogWriter
+	}
+
 	if h.devMode {
 		fmt.Println("")
 		fmt.Println("-----")
@@ -268,37 +523,39 @@ func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 		fmt.Println("method: ", request.Method)
 		fmt.Println("url: ", request.URL)
 		fmt.Println("uri: ", request.RequestURI)
+		fmt.Println("protocol: ", request.Proto)
 		fmt.Println("headers: ", request.Header)
 		fmt.Println("body:")
 		fmt.Println(request.Body)
 		fmt.Println("-----")
 	}
 
-	var userId, deviceId *string
-	var err error
-	token := request.Header.Get("Authorization")
-	token = strings.TrimPrefix(token, "Bearer ")
-
-	if token != "" && h.jwtSecret != "" {
+	if h.serveGatewayRoute(writer, request) {
+		return
+	}
 
-		userId, deviceId, err = h.getAuthData(token)
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
 
-		if err != nil {
-			http.Error(writer,
-				http.StatusText(http.StatusUnauthorized),
-				http.StatusUnauthorized)
-			return
-		}
+	err = h.checkCsrf(writer, request, identity)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
 	}
 
-	if h.onlyAuthorizedRequests && userId == nil {
+	h.trackDevice(request, identity)
+
+	if h.onlyAuthorizedRequests && identity == nil {
 		http.Error(writer,
 			http.StatusText(http.StatusUnauthorized),
 			http.StatusUnauthorized)
 		return
 	}
 
-	requestData, err := h.packRequest(userId, deviceId, request)
+	requestData, err := h.packRequest(identity, request)
 	if err != nil {
 		http.Error(writer,
 			http.StatusText(http.StatusInternalServerError),
@@ -331,6 +588,16 @@ func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
 		fmt.Println("-----")
 	}
 
+	if matchAnyUri(h.asyncRoutes, requestPath(request)) {
+		h.publishAsync(writer, cubeChannel, requestData)
+		return
+	}
+
+	if matchAnyUri(h.jobRoutes, requestPath(request)) {
+		h.startJob(writer, request, identity, cubeChannel, requestData)
+		return
+	}
+
 	response, err := h.cubeInstance.CallMethod(cubeChannel, *requestData, timeout)
 	if err != nil {
 		if err == cube.ErrorTimeout {
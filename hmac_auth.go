@@ -0,0 +1,173 @@
+package cube_http_gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hmacAuthScheme          = "HMAC-SHA256"
+	hmacTimestampHeader     = "X-Signature-Timestamp"
+	defaultHmacReplayWindow = 5 * time.Minute
+)
+
+//Verifies requests signed with per client secrets:
+//Authorization: HMAC-SHA256 Credential=clientId, SignedHeaders=host;content-type, Signature=hex.
+//Method, request uri, timestamp and body digest are always signed, SignedHeaders must contain host
+type hmacAuthenticator struct {
+	secrets      map[string][]byte
+	replayWindow time.Duration
+	seen         *expiringSet
+}
+
+//Secrets file is json object clientId -> secret
+func newHmacAuthenticator(secretsFile string, replayWindow time.Duration, stop <-chan struct{}) (*hmacAuthenticator, error) {
+	data, err := ioutil.ReadFile(secretsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawSecrets map[string]string
+
+	err = json.Unmarshal(data, &rawSecrets)
+	if err != nil {
+		return nil, fmt.Errorf("wrong hmac secrets file: %v", err)
+	}
+
+	secrets := map[string][]byte{}
+	for clientId, secret := range rawSecrets {
+		secrets[clientId] = []byte(secret)
+	}
+
+	return &hmacAuthenticator{
+		secrets:      secrets,
+		replayWindow: replayWindow,
+		seen:         newExpiringSet(replayWindow, stop),
+	}, nil
+}
+
+func parseHmacAuthorization(header string) (map[string]string, error) {
+	fields := map[string]string{}
+
+	for _, rawField := range strings.Split(strings.TrimPrefix(header, hmacAuthScheme+" "), ",") {
+		splittedField := strings.SplitN(strings.TrimSpace(rawField), "=", 2)
+		if len(splittedField) != 2 {
+			return nil, fmt.Errorf("wrong hmac authorization field: %v", rawField)
+		}
+
+		fields[splittedField[0]] = splittedField[1]
+	}
+
+	if fields["Credential"] == "" || fields["Signature"] == "" {
+		return nil, fmt.Errorf("hmac authorization without credential or signature")
+	}
+
+	return fields, nil
+}
+
+//String to sign is method, request uri, timestamp, signed headers as "name:value" and hex sha256 of body, separated by new lines
+func hmacStringToSign(request *http.Request, timestamp string, signedHeaders []string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	lines := []string{
+		request.Method,
+		request.URL.RequestURI(),
+		timestamp,
+	}
+
+	for _, name := range signedHeaders {
+		value := request.Header.Get(name)
+		if name == "host" {
+			value = request.Host
+		}
+
+		lines = append(lines, name+":"+strings.TrimSpace(value))
+	}
+
+	lines = append(lines, hex.EncodeToString(bodyHash[:]))
+	return strings.Join(lines, "\n")
+}
+
+func (a *hmacAuthenticator) authenticate(request *http.Request) (*identity, error) {
+	header := request.Header.Get("Authorization")
+	if !strings.HasPrefix(header, hmacAuthScheme+" ") {
+		return nil, nil
+	}
+
+	fields, err := parseHmacAuthorization(header)
+	if err != nil {
+		return nil, err
+	}
+
+	clientId := fields["Credential"]
+
+	secret := a.secrets[clientId]
+	if secret == nil {
+		return nil, fmt.Errorf("unknown hmac client")
+	}
+
+	timestamp := request.Header.Get(hmacTimestampHeader)
+
+	unixTime, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("wrong signature timestamp")
+	}
+
+	now := time.Now()
+	skew := now.Sub(time.Unix(unixTime, 0))
+	if skew > a.replayWindow || skew < -a.replayWindow {
+		return nil, fmt.Errorf("signature timestamp is out of replay window")
+	}
+
+	var body []byte
+	if request.Body != nil {
+		body, err = ioutil.ReadAll(request.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		request.Body.Close()
+		request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	signedHeaders := strings.Split(strings.ToLower(fields["SignedHeaders"]), ";")
+
+	hostSigned := false
+	for _, name := range signedHeaders {
+		if name == "host" {
+			hostSigned = true
+		}
+	}
+
+	if !hostSigned {
+		return nil, fmt.Errorf("hmac signed headers must contain host")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(hmacStringToSign(request, timestamp, signedHeaders, body)))
+	expectedSignature := mac.Sum(nil)
+
+	signature, err := hex.DecodeString(fields["Signature"])
+	if err != nil || !hmac.Equal(signature, expectedSignature) {
+		return nil, fmt.Errorf("wrong hmac signature")
+	}
+
+	//Keyed by verified signature bytes so differently encoded replays are caught
+	if !a.seen.add(hex.EncodeToString(expectedSignature), now.Add(2*a.replayWindow)) {
+		return nil, fmt.Errorf("replayed hmac signature")
+	}
+
+	return &identity{
+		method:   authMethodHmac,
+		clientId: &clientId,
+	}, nil
+}
@@ -0,0 +1,105 @@
+package cube_http_gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestHmacAuthenticator(t *testing.T) *hmacAuthenticator {
+	secretsFile := filepath.Join(t.TempDir(), "secrets.json")
+
+	err := ioutil.WriteFile(secretsFile, []byte(`{"partner": "secret"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator, err := newHmacAuthenticator(secretsFile, time.Minute, newTestStop(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return authenticator
+}
+
+func signHmacRequest(secret string, method string, uri string, body string, timestamp int64) (string, string) {
+	request := httptest.NewRequest(method, uri, strings.NewReader(body))
+	rawTimestamp := strconv.FormatInt(timestamp, 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(hmacStringToSign(request, rawTimestamp, []string{"host"}, []byte(body))))
+
+	return hex.EncodeToString(mac.Sum(nil)), rawTimestamp
+}
+
+func TestHmacAuthenticator(t *testing.T) {
+	authenticator := newTestHmacAuthenticator(t)
+	now := time.Now().Unix()
+
+	signature, timestamp := signHmacRequest("secret", "POST", "/orders", `{"id":1}`, now)
+	otherSignature, otherTimestamp := signHmacRequest("secret", "POST", "/orders", `{"id":2}`, now)
+	wrongSignature, _ := signHmacRequest("other", "POST", "/orders", `{"id":1}`, now)
+	staleSignature, staleTimestamp := signHmacRequest("secret", "POST", "/orders", `{"id":1}`, now-3600)
+	tamperedSignature, tamperedTimestamp := signHmacRequest("secret", "POST", "/orders", `{"id":4}`, now)
+
+	tests := []struct {
+		name          string
+		method        string
+		uri           string
+		credential    string
+		signedHeaders string
+		signature     string
+		timestamp     string
+		body          string
+		ok            bool
+	}{
+		{"valid", "POST", "/orders", "partner", "host", signature, timestamp, `{"id":1}`, true},
+		{"exact replay", "POST", "/orders", "partner", "host", signature, timestamp, `{"id":1}`, false},
+		{"upper case replay", "POST", "/orders", "partner", "host", strings.ToUpper(signature), timestamp, `{"id":1}`, false},
+		{"other request", "POST", "/orders", "partner", "host", otherSignature, otherTimestamp, `{"id":2}`, true},
+		{"tampered method", "PUT", "/orders", "partner", "host", tamperedSignature, tamperedTimestamp, `{"id":4}`, false},
+		{"tampered path", "POST", "/users", "partner", "host", tamperedSignature, tamperedTimestamp, `{"id":4}`, false},
+		{"tampered body", "POST", "/orders", "partner", "host", tamperedSignature, tamperedTimestamp, `{"id":3}`, false},
+		{"tampered date", "POST", "/orders", "partner", "host", tamperedSignature, strconv.FormatInt(now-1, 10), `{"id":4}`, false},
+		{"host is not signed", "POST", "/orders", "partner", "content-type", tamperedSignature, tamperedTimestamp, `{"id":4}`, false},
+		{"wrong secret", "POST", "/orders", "partner", "host", wrongSignature, timestamp, `{"id":1}`, false},
+		{"stale timestamp", "POST", "/orders", "partner", "host", staleSignature, staleTimestamp, `{"id":1}`, false},
+		{"unknown client", "POST", "/orders", "stranger", "host", signature, timestamp, `{"id":1}`, false},
+		{"untampered request", "POST", "/orders", "partner", "host", tamperedSignature, tamperedTimestamp, `{"id":4}`, true},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.uri, strings.NewReader(test.body))
+		request.Header.Set("Authorization", hmacAuthScheme+" Credential="+test.credential+", SignedHeaders="+test.signedHeaders+", Signature="+test.signature)
+		request.Header.Set(hmacTimestampHeader, test.timestamp)
+
+		identity, err := authenticator.authenticate(request)
+
+		if test.ok && (err != nil || identity == nil || *identity.clientId != test.credential) {
+			t.Errorf("%v: expected client %v, got %v, %v", test.name, test.credential, identity, err)
+		}
+
+		if !test.ok && err == nil {
+			t.Errorf("%v: expected error", test.name)
+		}
+	}
+}
+
+func TestHmacAuthenticatorSkipsOtherSchemes(t *testing.T) {
+	authenticator := newTestHmacAuthenticator(t)
+
+	request := httptest.NewRequest("GET", "/orders", nil)
+	request.Header.Set("Authorization", "Bearer token")
+
+	identity, err := authenticator.authenticate(request)
+	if identity != nil || err != nil {
+		t.Errorf("expected request to be skipped, got %v, %v", identity, err)
+	}
+}
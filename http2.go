@@ -0,0 +1,83 @@
+package cube_http_gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/akaumov/cube"
+)
+
+const (
+	http2ModeTls = "tls"
+	http2ModeH2c = "h2c"
+	http2ModeOff = "off"
+)
+
+func getIntParam(cubeInstance cube.Cube, name string) (int, error) {
+	rawValue := cubeInstance.GetParam(name)
+	if rawValue == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.Atoi(rawValue)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Wrong %v: %v\n", name, rawValue)
+	}
+
+	return value, nil
+}
+
+//Mode "tls" serves HTTP/2 on tls listener only, "h2c" also serves cleartext HTTP/2 on plain listener.
+//Zero limits keep net/http defaults
+func (h *Handler) initHttp2(cubeInstance cube.Cube) error {
+	mode := cubeInstance.GetParam("http2")
+	if mode == "" {
+		mode = http2ModeTls
+	}
+
+	if mode != http2ModeTls && mode != http2ModeH2c && mode != http2ModeOff {
+		return fmt.Errorf("Wrong http2 mode: %v\n", mode)
+	}
+
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+
+	if mode != http2ModeOff {
+		protocols.SetHTTP2(h.tlsConfig != nil)
+		protocols.SetUnencryptedHTTP2(mode == http2ModeH2c && h.tlsConfig == nil)
+	}
+
+	config := &http.HTTP2Config{}
+
+	var err error
+
+	config.MaxConcurrentStreams, err = getIntParam(cubeInstance, "http2MaxConcurrentStreams")
+	if err != nil {
+		return err
+	}
+
+	config.MaxReadFrameSize, err = getIntParam(cubeInstance, "http2MaxReadFrameSize")
+	if err != nil {
+		return err
+	}
+
+	config.MaxReceiveBufferPerStream, err = getIntParam(cubeInstance, "http2MaxStreamBuffer")
+	if err != nil {
+		return err
+	}
+
+	config.MaxReceiveBufferPerConnection, err = getIntParam(cubeInstance, "http2MaxConnectionBuffer")
+	if err != nil {
+		return err
+	}
+
+	config.PingTimeout, err = getDurationMsParam(cubeInstance, "http2PingTimeoutMs", 0)
+	if err != nil {
+		return err
+	}
+
+	h.httpProtocols = protocols
+	h.http2Config = config
+	return nil
+}
@@ -3,32 +3,10 @@ package crypto
 import (
 	"crypto"
 	"encoding/json"
-	"hash"
-	"io"
 )
 
-func init() {
-	crypto.RegisterHash(crypto.Hash(0), h)
-}
-
-// h is passed to crypto.RegisterHash.
-func h() hash.Hash {
-	return &f{Writer: nil}
-}
-
-type f struct{ io.Writer }
-
-// Sum helps implement the hash.Hash interface.
-func (_ *f) Sum(b []byte) []byte { return nil }
-
-// Reset helps implement the hash.Hash interface.
-func (_ *f) Reset() {}
-
-// Size helps implement the hash.Hash interface.
-func (_ *f) Size() int { return -1 }
-
-// BlockSize helps implement the hash.Hash interface.
-func (_ *f) BlockSize() int { return -1 }
+// Fork: upstream registers crypto.Hash(0) for the "none" algorithm in init,
+// which panics since Go 1.24. "none" never hashes, so nothing is registered.
 
 // Unsecured is the default "none" algorithm.
 var Unsecured = &SigningMethodNone{
@@ -6,8 +6,8 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/SermoDigital/jose"
-	"github.com/SermoDigital/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
 )
 
 // JWS implements a JWS per RFC 7515.
@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"testing"
 
-	"github.com/SermoDigital/jose"
-	"github.com/SermoDigital/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
 )
 
 var dataRaw = struct {
@@ -8,7 +8,7 @@ import (
 	"math/rand"
 	"testing"
 
-	"github.com/SermoDigital/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
 )
 
 type easy []byte
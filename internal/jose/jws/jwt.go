@@ -4,9 +4,9 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/SermoDigital/jose"
-	"github.com/SermoDigital/jose/crypto"
-	"github.com/SermoDigital/jose/jwt"
+	"github.com/akaumov/cube-http-gateway/internal/jose"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/jwt"
 )
 
 // NewJWT creates a new JWT with the given claims.
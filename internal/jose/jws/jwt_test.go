@@ -6,7 +6,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/SermoDigital/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
 )
 
 var claims = Claims{
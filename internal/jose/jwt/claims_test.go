@@ -4,9 +4,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/SermoDigital/jose/crypto"
-	"github.com/SermoDigital/jose/jws"
-	"github.com/SermoDigital/jose/jwt"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/jws"
+	"github.com/akaumov/cube-http-gateway/internal/jose/jwt"
 )
 
 func TestMultipleAudienceBug_AfterMarshal(t *testing.T) {
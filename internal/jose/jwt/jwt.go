@@ -3,7 +3,7 @@ package jwt
 import (
 	"time"
 
-	"github.com/SermoDigital/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
 )
 
 // JWT represents a JWT per RFC 7519.
@@ -0,0 +1,144 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/akaumov/cube"
+)
+
+const authMethodIntrospection = "introspection"
+
+var errTokenInactive = &tokenRejectedError{reason: "token is inactive"}
+
+//RFC 7662 introspection response
+type introspectionResponse struct {
+	Active   bool   `json:"active"`
+	Subject  string `json:"sub"`
+	Scope    string `json:"scope"`
+	ClientId string `json:"client_id"`
+	Exp      int64  `json:"exp"`
+}
+
+//Validates opaque OAuth2 access tokens with introspection endpoint
+type introspectionValidator struct {
+	endpoint         string
+	clientId         string
+	clientSecret     string
+	client           *http.Client
+	cacheTtl         time.Duration
+	negativeCacheTtl time.Duration
+	cache            *tokenCache
+}
+
+func newIntrospectionValidator(cubeInstance cube.Cube, timeout time.Duration) (*introspectionValidator, error) {
+	endpoint := cubeInstance.GetParam("introspectionUrl")
+	if endpoint == "" {
+		return nil, fmt.Errorf("introspection url is required for introspection validator")
+	}
+
+	cacheTtl, err := getDurationMsParam(cubeInstance, "introspectionCacheTtlMs", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	negativeCacheTtl, err := getDurationMsParam(cubeInstance, "authNegativeCacheTtlMs", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &introspectionValidator{
+		endpoint:         endpoint,
+		clientId:         cubeInstance.GetParam("introspectionClientId"),
+		clientSecret:     cubeInstance.GetParam("introspectionClientSecret"),
+		client:           &http.Client{Timeout: timeout},
+		cacheTtl:         cacheTtl,
+		negativeCacheTtl: negativeCacheTtl,
+		cache:            newTokenCache(tokenCacheSize),
+	}, nil
+}
+
+func (v *introspectionValidator) introspect(token string) (*introspectionResponse, error) {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("token_type_hint", "access_token")
+
+	request, err := http.NewRequest(http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	if v.clientId != "" {
+		request.SetBasicAuth(url.QueryEscape(v.clientId), url.QueryEscape(v.clientSecret))
+	}
+
+	response, err := v.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint status: %v", response.StatusCode)
+	}
+
+	var result introspectionResponse
+
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (v *introspectionValidator) validateToken(token string) (*identity, error) {
+	cachedIdentity, ok := v.cache.get(token)
+	if ok {
+		if cachedIdentity == nil {
+			return nil, errTokenInactive
+		}
+
+		return cachedIdentity, nil
+	}
+
+	result, err := v.introspect(token)
+	if err != nil {
+		return nil, &statusError{status: http.StatusServiceUnavailable, reason: "introspection failed: " + err.Error()}
+	}
+
+	now := time.Now()
+
+	if !result.Active || (result.Exp != 0 && result.Exp <= now.Unix()) {
+		v.cache.put(token, nil, now.Add(v.negativeCacheTtl))
+		return nil, errTokenInactive
+	}
+
+	identity := &identity{
+		method: authMethodIntrospection,
+		scopes: strings.Fields(result.Scope),
+	}
+
+	if result.Subject != "" {
+		identity.userId = &result.Subject
+	}
+
+	if result.ClientId != "" {
+		identity.clientId = &result.ClientId
+	}
+
+	expiresAt := now.Add(v.cacheTtl)
+	if result.Exp != 0 && time.Unix(result.Exp, 0).Before(expiresAt) {
+		expiresAt = time.Unix(result.Exp, 0)
+	}
+
+	v.cache.put(token, identity, expiresAt)
+	return identity, nil
+}
@@ -0,0 +1,473 @@
+package cube_http_gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	JobsChannel = "gateway.jobs"
+
+	jobsRoute         = "/jobs/"
+	callbackUrlHeader = "X-Callback-Url"
+	defaultJobTtl     = time.Hour
+
+	jobStatusPending = "pending"
+	jobStatusRunning = "running"
+	jobStatusDone    = "done"
+	jobStatusFailed  = "failed"
+
+	jobCompletedMethod = "jobCompleted"
+	jobCreatedMethod   = "jobCreated"
+	jobUpdateMethod    = "jobUpdate"
+)
+
+type job struct {
+	status      js.JobStatus
+	userId      *string
+	callbackUrl string
+	updatedAt   time.Time
+
+	//Job is started by this instance, only it sends callback
+	local bool
+
+	//Update can come before announcement, owner of job isn't known till then
+	announced bool
+}
+
+func (j *job) finished() bool {
+	return j.status.Status == jobStatusDone || j.status.Status == jobStatusFailed
+}
+
+//Jobs are shared by gateway instances over JobsChannel, so status can be read from any of them.
+//Job is kept for ttl after last update
+type jobStore struct {
+	mutex sync.Mutex
+	ttl   time.Duration
+	jobs  map[string]*job
+}
+
+func newJobStore(stop <-chan struct{}) *jobStore {
+	store := &jobStore{
+		ttl:  defaultJobTtl,
+		jobs: map[string]*job{},
+	}
+
+	go runEvery(time.Minute, store.prune, stop)
+	return store
+}
+
+func (store *jobStore) prune() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+
+	for id, storedJob := range store.jobs {
+		if now.Sub(storedJob.updatedAt) > store.ttl {
+			delete(store.jobs, id)
+		}
+	}
+}
+
+//Announces job, status of already known job is kept.
+//Returns job if it is finished before announcement, so its completion is not notified yet
+func (store *jobStore) add(newJob *job) *job {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	newJob.announced = true
+
+	storedJob, ok := store.jobs[newJob.status.Id]
+	if !ok {
+		newJob.updatedAt = time.Now()
+		store.jobs[newJob.status.Id] = newJob
+		return nil
+	}
+
+	if storedJob.announced {
+		return nil
+	}
+
+	storedJob.announced = true
+	storedJob.userId = newJob.userId
+	storedJob.callbackUrl = newJob.callbackUrl
+	storedJob.local = newJob.local
+
+	if !storedJob.finished() {
+		return nil
+	}
+
+	copiedJob := *storedJob
+	return &copiedJob
+}
+
+func (store *jobStore) remove(id string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.jobs, id)
+}
+
+func (store *jobStore) get(id string) *job {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storedJob, ok := store.jobs[id]
+	if !ok || !storedJob.announced || time.Since(storedJob.updatedAt) > store.ttl {
+		return nil
+	}
+
+	copiedJob := *storedJob
+	return &copiedJob
+}
+
+//Returns updated job and whether it is just finished, finished jobs are not updated anymore.
+//Unknown job is stored till its announcement comes, completion of it is notified by add
+func (store *jobStore) update(update js.JobUpdate) (*job, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	storedJob, ok := store.jobs[update.JobId]
+	if !ok {
+		storedJob = &job{status: js.JobStatus{Id: update.JobId}}
+		store.jobs[update.JobId] = storedJob
+	}
+
+	if storedJob.finished() {
+		return nil, false
+	}
+
+	storedJob.status.Status = update.Status
+	storedJob.status.Progress = update.Progress
+	storedJob.status.Message = update.Message
+	storedJob.status.Response = update.Response
+	storedJob.status.Error = update.Error
+	storedJob.updatedAt = time.Now()
+
+	copiedJob := *storedJob
+	return &copiedJob, storedJob.announced && storedJob.finished()
+}
+
+//Allowed callback url, path is prefix
+type callbackUrl struct {
+	scheme string
+	host   string
+	path   string
+}
+
+func parseCallbackUrls(rawUrls string) ([]callbackUrl, error) {
+	result := []callbackUrl{}
+
+	for _, rawUrl := range strings.Split(rawUrls, ";") {
+		rawUrl = strings.TrimSpace(rawUrl)
+		if rawUrl == "" {
+			continue
+		}
+
+		parsedUrl, err := url.Parse(strings.TrimSuffix(rawUrl, "*"))
+		if err != nil || parsedUrl.Host == "" || (parsedUrl.Scheme != "https" && parsedUrl.Scheme != "http") {
+			return nil, fmt.Errorf("Wrong job callback url: %v\n", rawUrl)
+		}
+
+		result = append(result, callbackUrl{
+			scheme: parsedUrl.Scheme,
+			host:   strings.ToLower(parsedUrl.Host),
+			path:   strings.TrimSuffix(parsedUrl.Path, "/"),
+		})
+	}
+
+	return result, nil
+}
+
+//Scheme and host must be equal, so allowed host can't be prefix of other host
+func matchCallbackUrl(allowedUrls []callbackUrl, rawUrl string) bool {
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil || parsedUrl.User != nil || parsedUrl.Opaque != "" {
+		return false
+	}
+
+	callbackPath := path.Clean("/" + parsedUrl.Path)
+
+	for _, allowedUrl := range allowedUrls {
+		if parsedUrl.Scheme != allowedUrl.scheme || strings.ToLower(parsedUrl.Host) != allowedUrl.host {
+			continue
+		}
+
+		if allowedUrl.path == "" || callbackPath == allowedUrl.path || strings.HasPrefix(callbackPath, allowedUrl.path+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Publishes request with job id as message id and answers with job location
+func (h *Handler) startJob(writer http.ResponseWriter, request *http.Request, identity *identity, channel cube.Channel, requestData *cube.Request) {
+	callbackUrl := request.Header.Get(callbackUrlHeader)
+	if callbackUrl != "" && !matchCallbackUrl(h.jobCallbackUrls, callbackUrl) {
+		http.Error(writer,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest)
+		return
+	}
+
+	newJob := &job{
+		status: js.JobStatus{
+			Id:     uuid.NewV4().String(),
+			Status: jobStatusPending,
+		},
+		callbackUrl: callbackUrl,
+		local:       true,
+	}
+
+	if identity != nil {
+		newJob.userId = identity.userId
+	}
+
+	h.jobs.add(newJob)
+
+	//Job is announced before request is published, so updates of fast worker find it on every instance
+	err := h.shareJob(newJob)
+	if err != nil {
+		h.jobs.remove(newJob.status.Id)
+		h.cubeInstance.LogError("Can't share job: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	err = h.cubeInstance.PublishMessage(channel, cube.Message{
+		Id:     newJob.status.Id,
+		Method: requestData.Method,
+		Params: requestData.Params,
+	})
+
+	if err != nil {
+		h.jobs.remove(newJob.status.Id)
+		h.failSharedJob(newJob.status.Id)
+		h.cubeInstance.LogError("Can't publish job request: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	writer.Header().Set("Location", jobsRoute+newJob.status.Id)
+	writeJson(writer, http.StatusAccepted, newJob.status)
+}
+
+//Announces job to other gateway instances
+func (h *Handler) shareJob(newJob *job) error {
+	packedParams, err := json.Marshal(js.JobCreated{
+		JobId:  newJob.status.Id,
+		UserId: newJob.userId,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return h.cubeInstance.PublishMessage(JobsChannel, cube.Message{
+		Id:     newJob.status.Id,
+		Method: jobCreatedMethod,
+		Params: (*json.RawMessage)(&packedParams),
+	})
+}
+
+//Other instances already know announced job, it is failed there when request isn't published
+func (h *Handler) failSharedJob(jobId string) {
+	packedParams, err := json.Marshal(js.JobUpdate{
+		JobId:   jobId,
+		Status:  jobStatusFailed,
+		Message: "job request is not published",
+	})
+
+	if err != nil {
+		return
+	}
+
+	err = h.cubeInstance.PublishMessage(JobsChannel, cube.Message{
+		Id:     jobId,
+		Method: jobUpdateMethod,
+		Params: (*json.RawMessage)(&packedParams),
+	})
+
+	if err != nil {
+		h.cubeInstance.LogError("Can't fail shared job: " + err.Error())
+	}
+}
+
+func (h *Handler) serveJobStatus(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	storedJob := h.jobs.get(strings.TrimPrefix(request.URL.Path, jobsRoute))
+	if storedJob == nil {
+		http.Error(writer,
+			http.StatusText(http.StatusNotFound),
+			http.StatusNotFound)
+		return
+	}
+
+	//Job of user is visible only to that user, anonymous job id works as capability
+	if storedJob.userId != nil && (identity == nil || identity.userId == nil || *identity.userId != *storedJob.userId) {
+		http.Error(writer,
+			http.StatusText(http.StatusNotFound),
+			http.StatusNotFound)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, storedJob.status)
+}
+
+func (h *Handler) sendJobCallback(instance cube.Cube, finishedJob *job) {
+	data, err := json.Marshal(finishedJob.status)
+	if err != nil {
+		return
+	}
+
+	client := http.Client{Timeout: time.Duration(h.timeoutMs) * time.Millisecond}
+
+	response, err := client.Post(finishedJob.callbackUrl, "application/json", bytes.NewReader(data))
+	if err != nil {
+		instance.LogWarning("Job callback failed: " + err.Error())
+		return
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		instance.LogWarning("Job callback failed with status " + response.Status)
+	}
+}
+
+func (h *Handler) notifyJobFinished(instance cube.Cube, finishedJob *job) {
+	if finishedJob.local && finishedJob.callbackUrl != "" {
+		go h.sendJobCallback(instance, finishedJob)
+	}
+
+	if !h.jobPush || finishedJob.userId == nil {
+		return
+	}
+
+	data, err := json.Marshal(finishedJob.status)
+	if err != nil {
+		return
+	}
+
+	_, err = h.push(finishedJob.status.Id, jobCompletedMethod, &js.PushParams{
+		UserId: *finishedJob.userId,
+		Data:   (*json.RawMessage)(&data),
+	})
+
+	if err != nil {
+		instance.LogError("Can't push job completion: " + err.Error())
+	}
+}
+
+func (h *Handler) onJobCreated(instance cube.Cube, message cube.Message) {
+	var created js.JobCreated
+
+	err := json.Unmarshal(*message.Params, &created)
+	if err != nil || created.JobId == "" {
+		instance.LogError("Wrong job announcement")
+		return
+	}
+
+	//Instance which started job already has it
+	finishedJob := h.jobs.add(&job{
+		status: js.JobStatus{
+			Id:     created.JobId,
+			Status: jobStatusPending,
+		},
+		userId: created.UserId,
+	})
+
+	if finishedJob != nil {
+		h.notifyJobFinished(instance, finishedJob)
+	}
+}
+
+//Job announcements and updates must reach every gateway instance, so JobsChannel is not subscribed with queue group.
+//Every instance pushes completion to its own connections
+func (h *Handler) onJobMessage(instance cube.Cube, message cube.Message) {
+	if message.Params == nil {
+		return
+	}
+
+	if message.Method == jobCreatedMethod {
+		h.onJobCreated(instance, message)
+		return
+	}
+
+	var update js.JobUpdate
+
+	err := json.Unmarshal(*message.Params, &update)
+	if err != nil {
+		instance.LogError("Wrong job update: " + err.Error())
+		return
+	}
+
+	switch update.Status {
+	case jobStatusRunning, jobStatusDone, jobStatusFailed:
+	default:
+		instance.LogError("Wrong job status: " + update.Status)
+		return
+	}
+
+	updatedJob, finished := h.jobs.update(update)
+	if updatedJob == nil || !finished {
+		return
+	}
+
+	h.notifyJobFinished(instance, updatedJob)
+}
+
+func (h *Handler) initJobs(cubeInstance cube.Cube) error {
+	h.jobRoutes = parseUriList(cubeInstance.GetParam("jobRoutes"))
+	if len(h.jobRoutes) == 0 {
+		return nil
+	}
+
+	ttl, err := getDurationMsParam(cubeInstance, "jobTtlMs", defaultJobTtl)
+	if err != nil {
+		return err
+	}
+
+	h.jobs.mutex.Lock()
+	h.jobs.ttl = ttl
+	h.jobs.mutex.Unlock()
+
+	h.jobCallbackUrls, err = parseCallbackUrls(cubeInstance.GetParam("jobCallbackUrls"))
+	if err != nil {
+		return err
+	}
+
+	h.jobPush = cubeInstance.GetParam("jobPush") == "true"
+
+	h.addGatewayRoute(jobsRoute+"*", h.serveJobStatus)
+	return nil
+}
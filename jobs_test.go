@@ -0,0 +1,221 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+var jobTestParams = map[string]string{
+	"jobRoutes": "/orders",
+}
+
+func startTestJob(t *testing.T, handler *Handler, token string) (int, js.JobStatus) {
+	request := httptest.NewRequest("POST", "/orders", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	var status js.JobStatus
+	json.Unmarshal(writer.Body.Bytes(), &status)
+
+	return writer.Code, status
+}
+
+func getTestJob(handler *Handler, id string, token string) int {
+	request := httptest.NewRequest("GET", "/jobs/"+id, nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	return writer.Code
+}
+
+func TestJobIsVisibleOnOtherInstance(t *testing.T) {
+	first, firstCube := newTestHandler(t, jobTestParams)
+	second, secondCube := newTestHandler(t, jobTestParams)
+
+	token := newTestToken(t, first, "user")
+
+	status, job := startTestJob(t, first, token)
+	if status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %v", status)
+	}
+
+	if code := getTestJob(second, job.Id, token); code != http.StatusNotFound {
+		t.Fatalf("expected 404 before announcement, got %v", code)
+	}
+
+	announcements := firstCube.publishedMessages(JobsChannel)
+	if len(announcements) != 1 {
+		t.Fatalf("expected one job announcement, got %v", len(announcements))
+	}
+
+	second.onJobMessage(secondCube, announcements[0])
+	//Own announcement coming back from bus keeps job local
+	first.onJobMessage(firstCube, announcements[0])
+
+	if code := getTestJob(second, job.Id, token); code != http.StatusOK {
+		t.Fatalf("expected 200 on other instance, got %v", code)
+	}
+
+	if code := getTestJob(second, job.Id, newTestToken(t, second, "other")); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other user, got %v", code)
+	}
+
+	if !first.jobs.get(job.Id).local || second.jobs.get(job.Id).local {
+		t.Fatal("only starting instance must own job callback")
+	}
+
+	update, _ := json.Marshal(js.JobUpdate{JobId: job.Id, Status: jobStatusDone})
+	second.onJobMessage(secondCube, cube.Message{
+		Id:     "update",
+		Method: "update",
+		Params: (*json.RawMessage)(&update),
+	})
+
+	if second.jobs.get(job.Id).status.Status != jobStatusDone {
+		t.Fatal("expected update to be applied on other instance")
+	}
+}
+
+func TestJobIsDroppedWhenPublishFails(t *testing.T) {
+	handler, fake := newTestHandler(t, jobTestParams)
+	token := newTestToken(t, handler, "user")
+
+	fake.publishErr = errors.New("bus is down")
+
+	status, _ := startTestJob(t, handler, token)
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %v", status)
+	}
+
+	if len(handler.jobs.jobs) != 0 {
+		t.Fatalf("expected no stored jobs, got %v", len(handler.jobs.jobs))
+	}
+}
+
+func publishTestJobUpdate(handler *Handler, fake *fakeCube, update js.JobUpdate) {
+	packedUpdate, _ := json.Marshal(update)
+	handler.onJobMessage(fake, cube.Message{
+		Id:     update.JobId,
+		Method: jobUpdateMethod,
+		Params: (*json.RawMessage)(&packedUpdate),
+	})
+}
+
+func TestJobIsAnnouncedBeforeRequest(t *testing.T) {
+	handler, fake := newTestHandler(t, jobTestParams)
+
+	status, _ := startTestJob(t, handler, newTestToken(t, handler, "user"))
+	if status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %v", status)
+	}
+
+	order := []cube.Channel{}
+	for _, channel := range fake.publishedChannels() {
+		if channel == JobsChannel || channel == "orders" {
+			order = append(order, channel)
+		}
+	}
+
+	if len(order) != 2 || order[0] != JobsChannel {
+		t.Fatalf("expected announcement before request, got %v", order)
+	}
+}
+
+func TestJobUpdateBeforeAnnouncement(t *testing.T) {
+	first, firstCube := newTestHandler(t, jobTestParams)
+	second, secondCube := newTestHandler(t, jobTestParams)
+
+	token := newTestToken(t, first, "user")
+	_, job := startTestJob(t, first, token)
+
+	publishTestJobUpdate(second, secondCube, js.JobUpdate{JobId: job.Id, Status: jobStatusDone})
+
+	if code := getTestJob(second, job.Id, token); code != http.StatusNotFound {
+		t.Fatalf("expected 404 before announcement, got %v", code)
+	}
+
+	second.onJobMessage(secondCube, firstCube.publishedMessages(JobsChannel)[0])
+
+	if code := getTestJob(second, job.Id, newTestToken(t, second, "other")); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other user, got %v", code)
+	}
+
+	storedJob := second.jobs.get(job.Id)
+	if storedJob == nil || storedJob.status.Status != jobStatusDone {
+		t.Fatalf("expected announcement to keep finished status, got %+v", storedJob)
+	}
+}
+
+func TestJobIsFailedWhenRequestPublishFails(t *testing.T) {
+	handler, fake := newTestHandler(t, jobTestParams)
+
+	fake.publishErr = errors.New("orders are down")
+	fake.publishErrChannel = "orders"
+
+	status, _ := startTestJob(t, handler, newTestToken(t, handler, "user"))
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %v", status)
+	}
+
+	messages := fake.publishedMessages(JobsChannel)
+	if len(messages) != 2 || messages[1].Method != jobUpdateMethod {
+		t.Fatalf("expected announcement and failure update, got %v", messages)
+	}
+
+	var update js.JobUpdate
+	json.Unmarshal(*messages[1].Params, &update)
+
+	if update.Status != jobStatusFailed {
+		t.Fatalf("expected failed job update, got %v", update.Status)
+	}
+}
+
+func TestMatchCallbackUrl(t *testing.T) {
+	allowedUrls, err := parseCallbackUrls("https://hooks.example.com/jobs;http://other.example.com:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://hooks.example.com/jobs", true},
+		{"https://hooks.example.com/jobs/123", true},
+		{"https://HOOKS.example.com/jobs/123", true},
+		{"https://hooks.example.com/jobsx", false},
+		{"https://hooks.example.com/jobs/../admin", false},
+		{"https://hooks.example.com/other", false},
+		{"http://hooks.example.com/jobs", false},
+		{"https://hooks.example.com.evil.com/jobs", false},
+		{"https://hooks.example.com@evil.com/jobs", false},
+		{"https://user@hooks.example.com/jobs", false},
+		{"https://hooks.example.com:444/jobs", false},
+		{"http://other.example.com:8080/anything", true},
+		{"http://other.example.com/anything", false},
+	}
+
+	for _, test := range tests {
+		if matchCallbackUrl(allowedUrls, test.url) != test.allowed {
+			t.Errorf("expected %v for %v", test.allowed, test.url)
+		}
+	}
+}
+
+func TestParseCallbackUrlsRejectsUrlWithoutHost(t *testing.T) {
+	for _, rawUrls := range []string{"hooks.example.com/jobs", "/jobs", "ftp://hooks.example.com"} {
+		if _, err := parseCallbackUrls(rawUrls); err == nil {
+			t.Errorf("expected error for %v", rawUrls)
+		}
+	}
+}
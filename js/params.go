@@ -1,5 +1,11 @@
 package js
 
+import (
+	"encoding/json"
+
+	"github.com/akaumov/cube"
+)
+
 type RequestParams struct {
 	InputTime  int64               `json:"inputTime"`
 	Method     string              `json:"method"`
@@ -10,6 +16,19 @@ type RequestParams struct {
 	UserId     *string             `json:"userId"`
 	DeviceId   *string             `json:"deviceId"`
 	Headers    map[string][]string `json:"headers"`
+	AuthMethod string              `json:"authMethod"`
+	ClientId   *string             `json:"clientId"`
+	ApiKeyId   *string             `json:"apiKeyId"`
+	Scopes     []string            `json:"scopes"`
+	Protocol   string              `json:"protocol"`
+
+	ClientCertificate *ClientCertificate `json:"clientCertificate"`
+}
+
+type ClientCertificate struct {
+	CommonName   string   `json:"commonName"`
+	Uris         []string `json:"uris"`
+	SerialNumber string   `json:"serialNumber"`
 }
 
 type Response struct {
@@ -17,3 +36,252 @@ type Response struct {
 	Headers map[string]string `json:"headers"`
 	Body    []byte            `json:"body"`
 }
+
+//Times are unix seconds. Zero IssuedBefore revokes all tokens until ExpiresAt, zero ExpiresAt revokes permanently.
+//UserId with DeviceId revokes only that device of user
+type Revocation struct {
+	Jti          *string `json:"jti"`
+	UserId       *string `json:"userId"`
+	DeviceId     *string `json:"deviceId"`
+	IssuedBefore int64   `json:"issuedBefore"`
+	ExpiresAt    int64   `json:"expiresAt"`
+}
+
+//Params of auth subject "verify" request. Rejected tokens are answered with error named InvalidToken,
+//other errors are treated as auth subject failure and not cached
+type AuthVerifyParams struct {
+	Token string `json:"token"`
+}
+
+//ExpiresAt is unix seconds
+type AuthVerifyResult struct {
+	UserId    *string `json:"userId"`
+	DeviceId  *string `json:"deviceId"`
+	ClientId  *string `json:"clientId"`
+	ExpiresAt int64   `json:"expiresAt"`
+}
+
+//Result of login subject, claims are added to gateway signed token.
+//Rejected credentials are answered with error named InvalidCredentials, other errors are treated as login subject failure
+type LoginResult struct {
+	UserId   string                 `json:"userId"`
+	DeviceId string                 `json:"deviceId"`
+	Claims   map[string]interface{} `json:"claims"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+type RefreshTokenParams struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+//Published on refresh, logout and refresh token reuse
+type AuthEvent struct {
+	UserId   string `json:"userId"`
+	DeviceId string `json:"deviceId"`
+	FamilyId string `json:"familyId"`
+	Time     int64  `json:"time"`
+}
+
+//ExpiresAt is unix seconds, query params of Path are signed too
+type SignUrlParams struct {
+	Path      string  `json:"path"`
+	ExpiresAt int64   `json:"expiresAt"`
+	UserId    *string `json:"userId"`
+}
+
+type SignUrlResult struct {
+	Url string `json:"url"`
+}
+
+//LastSeen is unix seconds
+type Device struct {
+	DeviceId  string `json:"deviceId"`
+	UserAgent string `json:"userAgent"`
+	LastSeen  int64  `json:"lastSeen"`
+}
+
+//Params of seen and signOut messages and of list request
+type DeviceMessage struct {
+	UserId string `json:"userId"`
+	Device Device `json:"device"`
+}
+
+//Frame of websocket connection in both directions.
+//Client frames with Reply are sent by CallMethod and answered with response frame, others are published
+type WebSocketFrame struct {
+	Type    string           `json:"type,omitempty"`
+	Id      string           `json:"id,omitempty"`
+	Subject string           `json:"subject,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  *json.RawMessage `json:"params,omitempty"`
+	Reply   bool             `json:"reply,omitempty"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *cube.Error      `json:"error,omitempty"`
+}
+
+//Params of bus messages and requests sent from websocket connection
+type WebSocketParams struct {
+	ConnectionId string           `json:"connectionId"`
+	UserId       *string          `json:"userId"`
+	DeviceId     *string          `json:"deviceId"`
+	ClientId     *string          `json:"clientId"`
+	Params       *json.RawMessage `json:"params"`
+}
+
+//Params of message written to websocket connection
+type WebSocketMessageParams struct {
+	ConnectionId string           `json:"connectionId"`
+	Data         *json.RawMessage `json:"data"`
+}
+
+//Params of message pushed to live connections of users and devices.
+//Push is fire-and-forget: it is published to every gateway instance and each one writes to its own connections.
+//Every instance publishes its own result to AckChannel if it is set, there is no acknowledgement of whole push
+type PushParams struct {
+	UserId     string           `json:"userId,omitempty"`
+	DeviceId   string           `json:"deviceId,omitempty"`
+	UserIds    []string         `json:"userIds,omitempty"`
+	DeviceIds  []string         `json:"deviceIds,omitempty"`
+	Data       *json.RawMessage `json:"data"`
+	AckChannel string           `json:"ackChannel,omitempty"`
+}
+
+//Delivery report of one gateway instance
+type PushResult struct {
+	MessageId     string   `json:"messageId"`
+	InstanceId    string   `json:"instanceId"`
+	Delivered     int      `json:"delivered"`
+	Dropped       int      `json:"dropped"`
+	ConnectionIds []string `json:"connectionIds"`
+	UserIds       []string `json:"userIds"`
+	DeviceIds     []string `json:"deviceIds"`
+}
+
+//Bus message of realtime topic
+type RealtimeEvent struct {
+	Id     string           `json:"id"`
+	Topic  string           `json:"topic"`
+	Method string           `json:"method,omitempty"`
+	Data   *json.RawMessage `json:"data"`
+}
+
+//Batch of long poll request, cursor is passed to the next request
+type LongPollResult struct {
+	Events []RealtimeEvent `json:"events"`
+	Cursor string          `json:"cursor"`
+}
+
+//Response of async route, id is the id of published message
+type AcceptedResult struct {
+	Id string `json:"id"`
+}
+
+//State of long running job, Response is set when job is done
+type JobStatus struct {
+	Id       string      `json:"id"`
+	Status   string      `json:"status"`
+	Progress int         `json:"progress"`
+	Message  string      `json:"message,omitempty"`
+	Response *Response   `json:"response,omitempty"`
+	Error    *cube.Error `json:"error,omitempty"`
+}
+
+//Published by gateway to gateway.jobs with method jobCreated so every instance knows the job
+type JobCreated struct {
+	JobId  string  `json:"jobId"`
+	UserId *string `json:"userId"`
+}
+
+//Published by backends to gateway.jobs, status is running, done or failed
+type JobUpdate struct {
+	JobId    string      `json:"jobId"`
+	Status   string      `json:"status"`
+	Progress int         `json:"progress"`
+	Message  string      `json:"message"`
+	Response *Response   `json:"response"`
+	Error    *cube.Error `json:"error"`
+}
+
+//Sub request of batch, it is sent after items listed in DependsOn succeed
+type BatchItem struct {
+	Id        string            `json:"id"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Headers   map[string]string `json:"headers"`
+	Body      json.RawMessage   `json:"body"`
+	DependsOn []string          `json:"dependsOn"`
+}
+
+//Json body is embedded as is, other bodies as string
+type BatchResult struct {
+	Id      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+//Id member of json-rpc request. Present tells "id": null apart from notification without id
+type JsonRpcId struct {
+	Present bool
+	Value   json.RawMessage
+}
+
+func (id *JsonRpcId) UnmarshalJSON(data []byte) error {
+	id.Present = true
+	id.Value = append(json.RawMessage{}, data...)
+	return nil
+}
+
+//Missing id is written as null
+func (id JsonRpcId) MarshalJSON() ([]byte, error) {
+	if len(id.Value) == 0 {
+		return []byte("null"), nil
+	}
+
+	return id.Value, nil
+}
+
+//Request without id is notification
+type JsonRpcRequest struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      JsonRpcId        `json:"id"`
+	Method  string           `json:"method"`
+	Params  *json.RawMessage `json:"params"`
+}
+
+type JsonRpcResponse struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      JsonRpcId        `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *JsonRpcError    `json:"error,omitempty"`
+}
+
+type JsonRpcError struct {
+	Code    int              `json:"code"`
+	Message string           `json:"message"`
+	Data    *json.RawMessage `json:"data,omitempty"`
+}
+
+//Params of bus request made from json-rpc call, Params are passed as sent by client
+type JsonRpcParams struct {
+	UserId   *string          `json:"userId"`
+	DeviceId *string          `json:"deviceId"`
+	ClientId *string          `json:"clientId"`
+	Scopes   []string         `json:"scopes"`
+	Params   *json.RawMessage `json:"params"`
+}
+
+//Message published for verified webhook, Body is raw request body
+type WebhookParams struct {
+	Route      string              `json:"route"`
+	DeliveryId string              `json:"deliveryId"`
+	Headers    map[string][]string `json:"headers"`
+	Body       []byte              `json:"body"`
+	ReceivedAt int64               `json:"receivedAt"`
+}
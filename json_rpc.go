@@ -0,0 +1,331 @@
+package cube_http_gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	jsonRpcVersion = "2.0"
+
+	jsonRpcParseError     = -32700
+	jsonRpcInvalidRequest = -32600
+	jsonRpcMethodNotFound = -32601
+	jsonRpcInvalidParams  = -32602
+	jsonRpcInternalError  = -32603
+	jsonRpcServerError    = -32000
+	jsonRpcTimeout        = -32001
+	jsonRpcUnavailable    = -32002
+
+	maxJsonRpcBodySize = 10 << 20
+)
+
+//cube.Error names with standard json-rpc codes, other names are server errors
+var jsonRpcErrorCodes = map[string]int{
+	"NotImplemented": jsonRpcMethodNotFound,
+	"MethodNotFound": jsonRpcMethodNotFound,
+	"WrongParams":    jsonRpcInvalidParams,
+	"InvalidParams":  jsonRpcInvalidParams,
+	"InternalError":  jsonRpcInternalError,
+}
+
+type jsonRpcMethod struct {
+	pattern Uri
+	subject BusSubject
+}
+
+//Format: "orders.get:orders;users.*:users", methods not matching any pattern are rejected
+func parseJsonRpcMethods(rawMethods string) ([]jsonRpcMethod, error) {
+	methods := []jsonRpcMethod{}
+
+	if rawMethods == "" {
+		return methods, nil
+	}
+
+	for _, rawMethod := range strings.Split(rawMethods, ";") {
+		splittedMethod := strings.Split(rawMethod, ":")
+
+		if len(splittedMethod) != 2 || splittedMethod[0] == "" || splittedMethod[1] == "" {
+			return nil, fmt.Errorf("Wrong json-rpc method format: %v\n", rawMethod)
+		}
+
+		methods = append(methods, jsonRpcMethod{
+			pattern: Uri(splittedMethod[0]),
+			subject: BusSubject(splittedMethod[1]),
+		})
+	}
+
+	return methods, nil
+}
+
+func (h *Handler) jsonRpcSubject(method string) BusSubject {
+	for _, rpcMethod := range h.jsonRpcMethods {
+		if matchUri(rpcMethod.pattern, Uri(method)) {
+			return rpcMethod.subject
+		}
+	}
+
+	return ""
+}
+
+func newJsonRpcError(id js.JsonRpcId, code int, message string, data string) *js.JsonRpcResponse {
+	rpcError := &js.JsonRpcError{
+		Code:    code,
+		Message: message,
+	}
+
+	if data != "" {
+		packedData, _ := json.Marshal(data)
+		rpcError.Data = (*json.RawMessage)(&packedData)
+	}
+
+	return &js.JsonRpcResponse{
+		JsonRpc: jsonRpcVersion,
+		Id:      id,
+		Error:   rpcError,
+	}
+}
+
+func packJsonRpcParams(identity *identity, params *json.RawMessage) (*json.RawMessage, error) {
+	rpcParams := js.JsonRpcParams{
+		Params: params,
+	}
+
+	if identity != nil {
+		rpcParams.UserId = identity.userId
+		rpcParams.DeviceId = identity.deviceId
+		rpcParams.ClientId = identity.clientId
+		rpcParams.Scopes = identity.scopes
+	}
+
+	packedParams, err := json.Marshal(rpcParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*json.RawMessage)(&packedParams), nil
+}
+
+//Returns nil response for notifications
+func (h *Handler) handleJsonRpcRequest(identity *identity, rawRequest json.RawMessage) *js.JsonRpcResponse {
+	var request js.JsonRpcRequest
+
+	err := json.Unmarshal(rawRequest, &request)
+	if err != nil || request.JsonRpc != jsonRpcVersion || request.Method == "" {
+		return newJsonRpcError(request.Id, jsonRpcInvalidRequest, "Invalid Request", "")
+	}
+
+	subject := h.jsonRpcSubject(request.Method)
+	if subject == "" {
+		if !request.Id.Present {
+			return nil
+		}
+
+		return newJsonRpcError(request.Id, jsonRpcMethodNotFound, "Method not found", "")
+	}
+
+	params, err := packJsonRpcParams(identity, request.Params)
+	if err != nil {
+		return newJsonRpcError(request.Id, jsonRpcInvalidParams, "Invalid params", "")
+	}
+
+	//Request without id is notification, it is published and not answered
+	if !request.Id.Present {
+		err = h.cubeInstance.PublishMessage(cube.Channel(subject), cube.Message{
+			Id:     uuid.NewV4().String(),
+			Method: request.Method,
+			Params: params,
+		})
+
+		if err != nil {
+			h.cubeInstance.LogError("Can't publish json-rpc notification: " + err.Error())
+		}
+
+		return nil
+	}
+
+	timeout := time.Duration(h.timeoutMs) * time.Millisecond
+
+	response, err := h.cubeInstance.CallMethod(cube.Channel(subject), cube.Request{
+		Method: request.Method,
+		Params: params,
+	}, timeout)
+
+	if err == cube.ErrorTimeout {
+		return newJsonRpcError(request.Id, jsonRpcTimeout, "Timeout", "")
+	}
+
+	if err != nil {
+		return newJsonRpcError(request.Id, jsonRpcUnavailable, "Unavailable", "")
+	}
+
+	if response.Error != nil {
+		code, ok := jsonRpcErrorCodes[response.Error.Name]
+		if !ok {
+			code = jsonRpcServerError
+		}
+
+		return newJsonRpcError(request.Id, code, response.Error.Name, response.Error.Message)
+	}
+
+	result := response.Result
+	if result == nil {
+		null := json.RawMessage("null")
+		result = &null
+	}
+
+	return &js.JsonRpcResponse{
+		JsonRpc: jsonRpcVersion,
+		Id:      request.Id,
+		Result:  result,
+	}
+}
+
+//Batch requests are handled in parallel, responses keep order of requests
+func (h *Handler) handleJsonRpcBatch(identity *identity, rawRequests []json.RawMessage) []*js.JsonRpcResponse {
+	responses := make([]*js.JsonRpcResponse, len(rawRequests))
+	slots := make(chan struct{}, defaultBatchConcurrency)
+
+	var wg sync.WaitGroup
+
+	for i := range rawRequests {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			slots <- struct{}{}
+			responses[i] = h.handleJsonRpcRequest(identity, rawRequests[i])
+			<-slots
+		}(i)
+	}
+
+	wg.Wait()
+
+	answered := []*js.JsonRpcResponse{}
+	for _, response := range responses {
+		if response != nil {
+			answered = append(answered, response)
+		}
+	}
+
+	return answered
+}
+
+func (h *Handler) serveJsonRpc(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	err = h.checkCsrf(writer, request, identity)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	if h.onlyAuthorizedRequests && identity == nil {
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return
+	}
+
+	h.trackDevice(request, identity)
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, maxJsonRpcBodySize))
+	if err != nil {
+		http.Error(writer,
+			http.StatusText(http.StatusRequestEntityTooLarge),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var rawRequests []json.RawMessage
+
+		err = json.Unmarshal(body, &rawRequests)
+		if err != nil {
+			writeJson(writer, http.StatusOK, newJsonRpcError(js.JsonRpcId{}, jsonRpcParseError, "Parse error", ""))
+			return
+		}
+
+		if len(rawRequests) == 0 {
+			writeJson(writer, http.StatusOK, newJsonRpcError(js.JsonRpcId{}, jsonRpcInvalidRequest, "Invalid Request", ""))
+			return
+		}
+
+		if len(rawRequests) > h.jsonRpcMaxBatch {
+			writeJson(writer, http.StatusOK, newJsonRpcError(js.JsonRpcId{}, jsonRpcInvalidRequest, "Invalid Request", "batch is too large"))
+			return
+		}
+
+		responses := h.handleJsonRpcBatch(identity, rawRequests)
+		if len(responses) == 0 {
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		writeJson(writer, http.StatusOK, responses)
+		return
+	}
+
+	if !json.Valid(body) {
+		writeJson(writer, http.StatusOK, newJsonRpcError(js.JsonRpcId{}, jsonRpcParseError, "Parse error", ""))
+		return
+	}
+
+	response := h.handleJsonRpcRequest(identity, body)
+	if response == nil {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJson(writer, http.StatusOK, response)
+}
+
+func (h *Handler) initJsonRpc(cubeInstance cube.Cube) error {
+	route := cubeInstance.GetParam("jsonRpcRoute")
+	if route == "" {
+		return nil
+	}
+
+	methods, err := parseJsonRpcMethods(cubeInstance.GetParam("jsonRpcMethods"))
+	if err != nil {
+		return err
+	}
+
+	maxBatch, err := getIntParam(cubeInstance, "jsonRpcMaxBatch")
+	if err != nil {
+		return err
+	}
+
+	if maxBatch == 0 {
+		maxBatch = defaultBatchMaxRequests
+	}
+
+	h.jsonRpcMethods = methods
+	h.jsonRpcMaxBatch = maxBatch
+	h.addGatewayRoute(Uri(route), h.serveJsonRpc)
+	return nil
+}
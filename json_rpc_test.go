@@ -0,0 +1,62 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveTestJsonRpc(handler *Handler, body string) (int, string) {
+	request := httptest.NewRequest("POST", "/rpc", strings.NewReader(body))
+	writer := httptest.NewRecorder()
+
+	handler.ServeHTTP(writer, request)
+	return writer.Code, strings.TrimSpace(writer.Body.String())
+}
+
+func TestJsonRpc(t *testing.T) {
+	handler, fake := newTestHandler(t, map[string]string{
+		"jsonRpcRoute":    "/rpc",
+		"jsonRpcMethods":  "orders.*:orders",
+		"jsonRpcMaxBatch": "3",
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		response string
+	}{
+		{"call", `{"jsonrpc": "2.0", "id": 1, "method": "orders.get"}`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":1,"result":{"status":200,"headers":null,"body":"b3JkZXJz"}}`},
+		{"null id is answered", `{"jsonrpc": "2.0", "id": null, "method": "orders.get"}`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":null,"result":{"status":200,"headers":null,"body":"b3JkZXJz"}}`},
+		{"notification", `{"jsonrpc": "2.0", "method": "orders.log"}`, http.StatusNoContent, ""},
+		{"unknown method", `{"jsonrpc": "2.0", "id": "a", "method": "users.get"}`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"Method not found"}}`},
+		{"wrong version", `{"jsonrpc": "1.0", "id": 2, "method": "orders.get"}`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"Invalid Request"}}`},
+		{"parse error", `{"jsonrpc"`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"Parse error"}}`},
+		{"empty batch", `[]`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}`},
+		{"batch", `[{"jsonrpc": "2.0", "id": 1, "method": "users.get"}, {"jsonrpc": "2.0", "method": "orders.log"}, 1]`, http.StatusOK,
+			`[{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"Method not found"}},{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request"}}]`},
+		{"too large batch", `[1, 2, 3, 4]`, http.StatusOK,
+			`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request","data":"batch is too large"}}`},
+	}
+
+	for _, test := range tests {
+		status, response := serveTestJsonRpc(handler, test.body)
+
+		if status != test.status || response != test.response {
+			t.Errorf("%v: expected %v %v, got %v %v", test.name, test.status, test.response, status, response)
+		}
+	}
+
+	channels := fake.publishedChannels()
+	if len(channels) != 2 || channels[0] != "orders" || channels[1] != "orders" {
+		t.Errorf("expected notifications to be published to orders, got %v", channels)
+	}
+}
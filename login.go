@@ -0,0 +1,200 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/internal/jose/crypto"
+	"github.com/akaumov/cube-http-gateway/internal/jose/jws"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const defaultLoginRoute = "/auth/token"
+
+//Error name login subject answers with for wrong credentials
+const loginErrorInvalidCredentials = "InvalidCredentials"
+
+//Claims set by gateway which login subject can't override
+var reservedClaims = map[string]bool{
+	"userId":   true,
+	"deviceId": true,
+	"jti":      true,
+	"iat":      true,
+	"exp":      true,
+	"nbf":      true,
+}
+
+func (h *Handler) signAccessToken(userId string, deviceId string, extraClaims map[string]interface{}) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(h.accessTokenLifetime)
+
+	claims := jws.Claims{}
+
+	for key, value := range extraClaims {
+		if !reservedClaims[key] {
+			claims.Set(key, value)
+		}
+	}
+
+	claims.Set("userId", userId)
+	claims.Set("deviceId", deviceId)
+	claims.SetJWTID(uuid.NewV4().String())
+	claims.SetIssuedAt(now)
+	claims.SetExpiration(expiresAt)
+
+	token, err := jws.NewJWT(claims, crypto.SigningMethodHS512).Serialize([]byte(h.jwtSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return string(token), expiresAt, nil
+}
+
+func writeJson(writer http.ResponseWriter, status int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(status)
+	writer.Write(data)
+}
+
+//Forwards credentials to login subject, returns nil result for rejected credentials
+func (h *Handler) callLoginSubject(request *http.Request) (*js.LoginResult, error) {
+	requestData, err := h.packRequest(nil, request)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(h.timeoutMs) * time.Millisecond
+
+	response, err := h.cubeInstance.CallMethod(cube.Channel(h.loginSubject), *requestData, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	//Only definitive rejection is answered with 401, other errors are failures of login subject
+	if response.Error != nil && response.Error.Name == loginErrorInvalidCredentials {
+		return nil, nil
+	}
+
+	if response.Error != nil {
+		return nil, fmt.Errorf("login subject failed: %v", response.Error.Name)
+	}
+
+	if response.Result == nil {
+		return nil, fmt.Errorf("login subject returned no result")
+	}
+
+	var result js.LoginResult
+
+	err = json.Unmarshal(*response.Result, &result)
+	if err != nil {
+		return nil, fmt.Errorf("wrong login subject response: %v", err)
+	}
+
+	if result.UserId == "" {
+		return nil, fmt.Errorf("login subject response without userId")
+	}
+
+	return &result, nil
+}
+
+//Response with signed access token, refresh token is set by caller
+func (h *Handler) newTokenResponse(result *js.LoginResult) (*js.TokenResponse, error) {
+	accessToken, expiresAt, err := h.signAccessToken(result.UserId, result.DeviceId, result.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &js.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(time.Until(expiresAt) / time.Second),
+	}, nil
+}
+
+//Refresh token is issued in refresh token family when refresh tokens are enabled
+func (h *Handler) issueTokens(writer http.ResponseWriter, familyId string, result *js.LoginResult) {
+	response, err := h.newTokenResponse(result)
+	if err != nil {
+		h.cubeInstance.LogError("Can't sign access token: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	if h.refreshTokens != nil {
+		response.RefreshToken, err = h.createRefreshToken(familyId, result)
+		if err != nil {
+			h.cubeInstance.LogError("Can't create refresh token: " + err.Error())
+			http.Error(writer,
+				http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJson(writer, http.StatusOK, response)
+}
+
+func (h *Handler) serveLogin(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := h.callLoginSubject(request)
+	if err != nil {
+		if err == cube.ErrorTimeout {
+			http.Error(writer,
+				http.StatusText(http.StatusGatewayTimeout),
+				http.StatusGatewayTimeout)
+			return
+		}
+
+		h.cubeInstance.LogError("Login failed: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusBadGateway),
+			http.StatusBadGateway)
+		return
+	}
+
+	if result == nil {
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return
+	}
+
+	if h.deviceBinding != "" {
+		fingerprint := h.requestDeviceFingerprint(request)
+		if fingerprint == "" {
+			http.Error(writer,
+				http.StatusText(http.StatusBadRequest),
+				http.StatusBadRequest)
+			return
+		}
+
+		if result.Claims == nil {
+			result.Claims = map[string]interface{}{}
+		}
+
+		result.Claims[deviceFingerprintClaim] = fingerprint
+	}
+
+	h.issueTokens(writer, "", result)
+}
@@ -0,0 +1,43 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func loginTestStatus(t *testing.T, response cube.Response) int {
+	handler, fake := newTestHandler(t, map[string]string{"loginSubject": "login"})
+
+	fake.call = func(channel cube.Channel, request cube.Request) (*cube.Response, error) {
+		return &response, nil
+	}
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest("POST", defaultLoginRoute, nil))
+	return writer.Code
+}
+
+func TestLoginSubjectErrors(t *testing.T) {
+	packedResult, _ := json.Marshal(js.LoginResult{UserId: "user", DeviceId: "device"})
+
+	tests := []struct {
+		response cube.Response
+		status   int
+	}{
+		{cube.NewResultResponse("", (*json.RawMessage)(&packedResult)), http.StatusOK},
+		{cube.NewErrorResponse("", loginErrorInvalidCredentials, ""), http.StatusUnauthorized},
+		{cube.NewErrorResponse("", "InternalError", "database is down"), http.StatusBadGateway},
+		{cube.NewResultResponse("", nil), http.StatusBadGateway},
+	}
+
+	for _, test := range tests {
+		if status := loginTestStatus(t, test.response); status != test.status {
+			t.Errorf("expected %v for %+v, got %v", test.status, test.response.Error, status)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	defaultLongPollTimeout = 25 * time.Second
+	longPollMaxBatch       = 100
+	longPollCursorParam    = "cursor"
+)
+
+//Waiting long poll request, it is closed on device sign out
+type longPollConnection struct {
+	*closeSignal
+	id       string
+	identity *identity
+}
+
+func (c *longPollConnection) connectionId() string {
+	return c.id
+}
+
+func (c *longPollConnection) connectionIdentity() *identity {
+	return c.identity
+}
+
+func (c *longPollConnection) send(frame []byte) bool {
+	return false
+}
+
+func (h *Handler) longPollResult(subjects map[BusSubject]string, cursor uint64) *js.LongPollResult {
+	events := h.topics.since(subjects, cursor)
+	if len(events) > longPollMaxBatch {
+		events = events[:longPollMaxBatch]
+	}
+
+	result := &js.LongPollResult{
+		Events: []js.RealtimeEvent{},
+		Cursor: h.topics.formatEventId(cursor),
+	}
+
+	for _, event := range events {
+		data := event.data
+
+		result.Events = append(result.Events, js.RealtimeEvent{
+			Id:     h.topics.formatEventId(event.id),
+			Topic:  subjects[event.subject],
+			Method: event.method,
+			Data:   (*json.RawMessage)(&data),
+		})
+
+		result.Cursor = h.topics.formatEventId(event.id)
+	}
+
+	return result
+}
+
+//Holds request until events after cursor arrive or timeout passes.
+//Request without cursor waits for events published after it
+func (h *Handler) serveLongPoll(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	query := request.URL.Query()
+
+	subjects, err := h.authorizeTopics(identity, query.Get(topicsQueryParam))
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	h.trackDevice(request, identity)
+
+	subscription := h.topics.subscribe(subjects, 1)
+	defer h.topics.unsubscribe(subscription)
+
+	cursor := h.topics.currentId()
+
+	rawCursor := query.Get(longPollCursorParam)
+	if rawCursor != "" {
+		//Cursor of other instance or from before gateway restart gets whole replay buffer
+		cursor = h.topics.parseEventId(rawCursor)
+
+		result := h.longPollResult(subjects, cursor)
+		if len(result.Events) > 0 {
+			writeJson(writer, http.StatusOK, result)
+			return
+		}
+	}
+
+	timer := time.NewTimer(h.longPollTimeout)
+	defer timer.Stop()
+
+	connection := &longPollConnection{
+		closeSignal: newCloseSignal(),
+		id:          uuid.NewV4().String(),
+		identity:    identity,
+	}
+
+	if identity != nil {
+		h.connections.addWaiting(connection)
+		defer h.connections.removeWaiting(connection)
+	}
+
+	select {
+	case <-subscription.events:
+	case <-timer.C:
+	case <-connection.closed:
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return
+	case <-request.Context().Done():
+		return
+	}
+
+	writeJson(writer, http.StatusOK, h.longPollResult(subjects, cursor))
+}
+
+func (h *Handler) initLongPoll(cubeInstance cube.Cube) error {
+	route := cubeInstance.GetParam("longPollRoute")
+	if route == "" {
+		return nil
+	}
+
+	//Events are answered from replay buffer, without it waiting request would get nothing
+	if !h.topics.replays() {
+		return fmt.Errorf("long poll requires realtime replay size above zero")
+	}
+
+	timeout, err := getDurationMsParam(cubeInstance, "longPollTimeoutMs", defaultLongPollTimeout)
+	if err != nil {
+		return err
+	}
+
+	h.longPollTimeout = timeout
+	h.addGatewayRoute(Uri(route), h.serveLongPoll)
+	return nil
+}
@@ -0,0 +1,106 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+var longPollTestParams = map[string]string{
+	"realtimeTopics":    "news:gateway.events.news",
+	"longPollRoute":     "/poll",
+	"longPollTimeoutMs": "50",
+}
+
+func pollTestEvents(t *testing.T, handler *Handler, cursor string) (int, js.LongPollResult) {
+	query := url.Values{topicsQueryParam: {"news"}}
+	if cursor != "" {
+		query.Set(longPollCursorParam, cursor)
+	}
+
+	request := httptest.NewRequest("GET", "/poll?"+query.Encode(), nil)
+	request.Header.Set("Authorization", "Bearer "+newTestToken(t, handler, "user"))
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	var result js.LongPollResult
+	json.Unmarshal(writer.Body.Bytes(), &result)
+
+	return writer.Code, result
+}
+
+func TestLongPollTimeout(t *testing.T) {
+	handler, _ := newTestHandler(t, longPollTestParams)
+
+	startTime := time.Now()
+
+	status, result := pollTestEvents(t, handler, "")
+	if status != http.StatusOK || len(result.Events) != 0 {
+		t.Fatalf("expected empty result on timeout, got %v %v", status, result.Events)
+	}
+
+	if time.Since(startTime) < 50*time.Millisecond {
+		t.Fatal("expected request to be held until timeout")
+	}
+
+	if result.Cursor != handler.topics.formatEventId(handler.topics.currentId()) {
+		t.Fatalf("expected cursor of current event, got %v", result.Cursor)
+	}
+}
+
+func TestLongPollCursor(t *testing.T) {
+	handler, _ := newTestHandler(t, longPollTestParams)
+
+	handler.topics.publish("gateway.events.news", "created", json.RawMessage(`{"n":1}`))
+	cursor := handler.topics.formatEventId(handler.topics.currentId())
+	handler.topics.publish("gateway.events.news", "created", json.RawMessage(`{"n":2}`))
+
+	status, result := pollTestEvents(t, handler, cursor)
+	if status != http.StatusOK || len(result.Events) != 1 || string(*result.Events[0].Data) != `{"n":2}` {
+		t.Fatalf("expected event after cursor, got %v %v", status, result.Events)
+	}
+
+	status, result = pollTestEvents(t, handler, result.Cursor)
+	if status != http.StatusOK || len(result.Events) != 0 {
+		t.Fatalf("expected no events after last cursor, got %v %v", status, result.Events)
+	}
+}
+
+func TestLongPollCursorFromBeforeRestart(t *testing.T) {
+	handler, _ := newTestHandler(t, longPollTestParams)
+
+	handler.topics.publish("gateway.events.news", "created", json.RawMessage(`{"n":1}`))
+	handler.topics.publish("gateway.events.news", "created", json.RawMessage(`{"n":2}`))
+
+	status, result := pollTestEvents(t, handler, "previous-100")
+	if status != http.StatusOK || len(result.Events) != 2 {
+		t.Fatalf("expected whole replay buffer for cursor of previous run, got %v %v", status, result.Events)
+	}
+}
+
+func TestLongPollRequiresReplayBuffer(t *testing.T) {
+	handler := &Handler{}
+	handler.OnInitInstance()
+	defer handler.OnStop(nil)
+
+	fake := &fakeCube{params: map[string]string{
+		"realtimeTopics":     "news:gateway.events.news",
+		"longPollRoute":      "/poll",
+		"realtimeReplaySize": "0",
+	}}
+
+	err := handler.initRealtime(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if handler.initLongPoll(fake) == nil {
+		t.Fatal("expected long poll without replay buffer to be rejected")
+	}
+}
@@ -0,0 +1,121 @@
+package cube_http_gateway
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+type clientCertRule struct {
+	route      Uri
+	identities []string
+}
+
+//Authorizes client certificates on routes with rules
+type clientCertAuthenticator struct {
+	rules []clientCertRule
+}
+
+//Format: "/route=identity,identity;/prefix/*=spiffe://domain/*"
+func parseClientCertRules(rawRules string) ([]clientCertRule, error) {
+	rules := []clientCertRule{}
+
+	if rawRules == "" {
+		return rules, nil
+	}
+
+	for _, rawRule := range strings.Split(rawRules, ";") {
+		splittedRule := strings.SplitN(rawRule, "=", 2)
+
+		if len(splittedRule) != 2 || splittedRule[1] == "" {
+			return nil, fmt.Errorf("Wrong client cert rule format: %v\n", rawRule)
+		}
+
+		rules = append(rules, clientCertRule{
+			route:      Uri(splittedRule[0]),
+			identities: strings.Split(splittedRule[1], ","),
+		})
+	}
+
+	return rules, nil
+}
+
+//Certificate identities are SAN uris (e.g. SPIFFE ids) and common name
+func certificateIdentities(certificate *x509.Certificate) []string {
+	identities := []string{}
+
+	for _, uri := range certificate.URIs {
+		identities = append(identities, uri.String())
+	}
+
+	if certificate.Subject.CommonName != "" {
+		identities = append(identities, certificate.Subject.CommonName)
+	}
+
+	return identities
+}
+
+func clientCertificate(request *http.Request) *x509.Certificate {
+	if request.TLS == nil || len(request.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return request.TLS.PeerCertificates[0]
+}
+
+func packClientCertificate(request *http.Request) *js.ClientCertificate {
+	certificate := clientCertificate(request)
+	if certificate == nil {
+		return nil
+	}
+
+	uris := []string{}
+	for _, uri := range certificate.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	return &js.ClientCertificate{
+		CommonName:   certificate.Subject.CommonName,
+		Uris:         uris,
+		SerialNumber: certificate.SerialNumber.String(),
+	}
+}
+
+func (a *clientCertAuthenticator) authenticate(request *http.Request) (*identity, error) {
+	path := requestPath(request)
+
+	var rule *clientCertRule
+	for i := range a.rules {
+		if matchUri(a.rules[i].route, path) {
+			rule = &a.rules[i]
+			break
+		}
+	}
+
+	if rule == nil {
+		return nil, nil
+	}
+
+	certificate := clientCertificate(request)
+	if certificate == nil {
+		return nil, fmt.Errorf("client certificate is required")
+	}
+
+	for _, certIdentity := range certificateIdentities(certificate) {
+		for _, allowed := range rule.identities {
+			if matchUri(Uri(allowed), Uri(certIdentity)) {
+				clientId := certIdentity
+
+				return &identity{
+					method:   authMethodClientCert,
+					clientId: &clientId,
+				}, nil
+			}
+		}
+	}
+
+	return nil, &statusError{status: http.StatusForbidden, reason: "client certificate is not allowed for route"}
+}
@@ -0,0 +1,114 @@
+package cube_http_gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestClientCertificate(t *testing.T, commonName string, uris ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, rawUri := range uris {
+		uri, err := url.Parse(rawUri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		template.URIs = append(template.URIs, uri)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	rules, err := parseClientCertRules("/orders=spiffe://example.org/billing,partner;/admin/*=spiffe://example.org/admin/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := &clientCertAuthenticator{rules: rules}
+
+	billing := newTestClientCertificate(t, "billing", "spiffe://example.org/billing")
+	partner := newTestClientCertificate(t, "partner")
+	admin := newTestClientCertificate(t, "", "spiffe://example.org/admin/ops")
+	stranger := newTestClientCertificate(t, "stranger", "spiffe://example.org/stranger")
+
+	tests := []struct {
+		name        string
+		target      string
+		certificate *x509.Certificate
+		status      int
+		clientId    string
+	}{
+		{"san uri", "/orders", billing, http.StatusOK, "spiffe://example.org/billing"},
+		{"common name", "/orders", partner, http.StatusOK, "partner"},
+		{"prefix pattern", "/admin/users", admin, http.StatusOK, "spiffe://example.org/admin/ops"},
+		{"identity outside of prefix pattern", "/admin/users", billing, http.StatusForbidden, ""},
+		{"identity not allowed", "/orders", stranger, http.StatusForbidden, ""},
+		{"missing certificate", "/orders", nil, http.StatusUnauthorized, ""},
+		{"route without rule", "/users", nil, http.StatusOK, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", test.target, nil)
+			if test.certificate != nil {
+				request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.certificate}}
+			}
+
+			identity, err := authenticator.authenticate(request)
+
+			status := http.StatusOK
+			if err != nil {
+				status = http.StatusUnauthorized
+				if statusErr, ok := err.(*statusError); ok {
+					status = statusErr.status
+				}
+			}
+
+			if status != test.status {
+				t.Fatalf("expected status %v, got %v (%v)", test.status, status, err)
+			}
+
+			clientId := ""
+			if identity != nil {
+				clientId = *identity.clientId
+			}
+
+			if clientId != test.clientId {
+				t.Fatalf("expected client %v, got %v", test.clientId, clientId)
+			}
+		})
+	}
+}
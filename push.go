@@ -0,0 +1,156 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	PushChannel = "gateway.push"
+
+	webSocketFramePush = "push"
+)
+
+func containsString(list []string, value *string) bool {
+	if value == nil {
+		return false
+	}
+
+	for _, item := range list {
+		if item == *value {
+			return true
+		}
+	}
+
+	return false
+}
+
+//Returns live connections of any of users or devices
+func (hub *connectionHub) find(userIds []string, deviceIds []string) []liveConnection {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	connections := []liveConnection{}
+
+	for _, connection := range hub.connections {
+		identity := connection.connectionIdentity()
+
+		if containsString(userIds, identity.userId) || containsString(deviceIds, identity.deviceId) {
+			connections = append(connections, connection)
+		}
+	}
+
+	return connections
+}
+
+func parsePushParams(rawParams *json.RawMessage) (*js.PushParams, error) {
+	var params js.PushParams
+
+	if rawParams == nil {
+		return &params, nil
+	}
+
+	err := json.Unmarshal(*rawParams, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &params, nil
+}
+
+//Writes message to every matching connection of this instance
+func (h *Handler) push(messageId string, method string, params *js.PushParams) (*js.PushResult, error) {
+	userIds := params.UserIds
+	if params.UserId != "" {
+		userIds = append(userIds, params.UserId)
+	}
+
+	deviceIds := params.DeviceIds
+	if params.DeviceId != "" {
+		deviceIds = append(deviceIds, params.DeviceId)
+	}
+
+	if messageId == "" {
+		messageId = uuid.NewV4().String()
+	}
+
+	frame, err := json.Marshal(js.WebSocketFrame{
+		Type:   webSocketFramePush,
+		Id:     messageId,
+		Method: method,
+		Params: params.Data,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &js.PushResult{
+		MessageId:     messageId,
+		ConnectionIds: []string{},
+		UserIds:       []string{},
+		DeviceIds:     []string{},
+	}
+
+	for _, connection := range h.connections.find(userIds, deviceIds) {
+		if !connection.send(frame) {
+			result.Dropped++
+			continue
+		}
+
+		identity := connection.connectionIdentity()
+
+		result.Delivered++
+		result.ConnectionIds = append(result.ConnectionIds, connection.connectionId())
+
+		if identity.userId != nil && !containsString(result.UserIds, identity.userId) {
+			result.UserIds = append(result.UserIds, *identity.userId)
+		}
+
+		if identity.deviceId != nil && !containsString(result.DeviceIds, identity.deviceId) {
+			result.DeviceIds = append(result.DeviceIds, *identity.deviceId)
+		}
+	}
+
+	return result, nil
+}
+
+//Push messages reach every gateway instance, each one reports its own deliveries to ackChannel if it is set.
+//Push isn't accepted as request, because answer of one instance doesn't cover connections of others
+func (h *Handler) onPushMessage(instance cube.Cube, message cube.Message) {
+	params, err := parsePushParams(message.Params)
+	if err != nil {
+		instance.LogError("Wrong push message: " + err.Error())
+		return
+	}
+
+	result, err := h.push(message.Id, message.Method, params)
+	if err != nil {
+		instance.LogError("Can't push message: " + err.Error())
+		return
+	}
+
+	if params.AckChannel == "" {
+		return
+	}
+
+	result.InstanceId = instance.GetInstanceId()
+
+	packedResult, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	err = instance.PublishMessage(cube.Channel(params.AckChannel), cube.Message{
+		Id:     uuid.NewV4().String(),
+		Method: "ack",
+		Params: (*json.RawMessage)(&packedResult),
+	})
+
+	if err != nil {
+		instance.LogError("Can't publish push ack: " + err.Error())
+	}
+}
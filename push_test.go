@@ -0,0 +1,85 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func newTestPushConnection(id string, userId string, deviceId string, buffer int) *sseConnection {
+	return &sseConnection{
+		closeSignal: newCloseSignal(),
+		id:          id,
+		identity:    &identity{userId: &userId, deviceId: &deviceId},
+		frames:      make(chan []byte, buffer),
+	}
+}
+
+func TestPushIsWrittenToMatchingConnections(t *testing.T) {
+	handler, _ := newTestHandler(t, nil)
+
+	phone := newTestPushConnection("phone", "user", "phone", 1)
+	laptop := newTestPushConnection("laptop", "user", "laptop", 0)
+	other := newTestPushConnection("other", "other", "tablet", 1)
+
+	handler.connections.add(phone)
+	handler.connections.add(laptop)
+	handler.connections.add(other)
+
+	data := json.RawMessage(`{"text":"hi"}`)
+
+	result, err := handler.push("message", "notify", &js.PushParams{UserId: "user", Data: &data})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Delivered != 1 || result.Dropped != 1 || len(result.ConnectionIds) != 1 || result.ConnectionIds[0] != "phone" {
+		t.Fatalf("expected delivery to phone and drop for full laptop, got %+v", result)
+	}
+
+	if len(other.frames) != 0 {
+		t.Fatal("expected no push to other user")
+	}
+}
+
+func TestPushAckIsReportedPerInstance(t *testing.T) {
+	handler, fake := newTestHandler(t, nil)
+	handler.connections.add(newTestPushConnection("phone", "user", "phone", 1))
+
+	packedParams, _ := json.Marshal(js.PushParams{UserId: "user", AckChannel: "acks"})
+
+	handler.OnReceiveMessage(fake, PushChannel, cube.Message{
+		Id:     "message",
+		Method: "notify",
+		Params: (*json.RawMessage)(&packedParams),
+	})
+
+	acks := fake.publishedMessages("acks")
+	if len(acks) != 1 {
+		t.Fatalf("expected one ack, got %v", len(acks))
+	}
+
+	var result js.PushResult
+	json.Unmarshal(*acks[0].Params, &result)
+
+	if result.InstanceId != fake.GetInstanceId() || result.MessageId != "message" || result.Delivered != 1 {
+		t.Fatalf("expected delivery report of instance, got %+v", result)
+	}
+}
+
+func TestPushRequestIsNotAccepted(t *testing.T) {
+	handler, fake := newTestHandler(t, nil)
+
+	packedParams, _ := json.Marshal(js.PushParams{UserId: "user"})
+
+	response := handler.OnReceiveRequest(fake, PushChannel, cube.Request{
+		Method: "notify",
+		Params: (*json.RawMessage)(&packedParams),
+	})
+
+	if response.Error == nil {
+		t.Fatal("expected push request to be rejected")
+	}
+}
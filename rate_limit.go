@@ -0,0 +1,80 @@
+package cube_http_gateway
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+//Fixed one minute window limiter keyed by client
+type rateLimiter struct {
+	mutex   sync.Mutex
+	limits  map[string]int
+	windows map[string]*rateWindow
+}
+
+func newRateLimiter(limits map[string]int) *rateLimiter {
+	return &rateLimiter{
+		limits:  limits,
+		windows: map[string]*rateWindow{},
+	}
+}
+
+//Tier without configured limit is not limited
+func (l *rateLimiter) allow(key string, tier string) bool {
+	limit, ok := l.limits[tier]
+	if !ok {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	window := l.windows[key]
+
+	if window == nil || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		l.windows[key] = window
+	}
+
+	if window.count >= limit {
+		return false
+	}
+
+	window.count++
+	return true
+}
+
+//Format: "tier:requestsPerMinute;tier:requestsPerMinute"
+func parseRateLimitTiers(rawTiers string) (map[string]int, error) {
+	tiers := map[string]int{}
+
+	if rawTiers == "" {
+		return tiers, nil
+	}
+
+	for _, rawTier := range strings.Split(rawTiers, ";") {
+		splittedTier := strings.Split(rawTier, ":")
+
+		if len(splittedTier) != 2 {
+			return nil, fmt.Errorf("Wrong tiers format: %v\n", rawTier)
+		}
+
+		limit, err := strconv.Atoi(splittedTier[1])
+		if err != nil {
+			return nil, fmt.Errorf("Wrong tier limit: %v\n", rawTier)
+		}
+
+		tiers[splittedTier[0]] = limit
+	}
+
+	return tiers, nil
+}
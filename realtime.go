@@ -0,0 +1,364 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akaumov/cube"
+)
+
+const (
+	//Topic subjects must be under this prefix to be received by gateway
+	RealtimeChannel       = "gateway.events.>"
+	realtimeSubjectPrefix = "gateway.events."
+
+	realtimeUserIdTemplate = "{userId}"
+	defaultReplaySize      = 100
+	defaultBufferTtl       = 10 * time.Minute
+	topicsQueryParam       = "topics"
+)
+
+//Bus message delivered to realtime topic subscribers
+type realtimeEvent struct {
+	id      uint64
+	subject BusSubject
+	method  string
+	data    json.RawMessage
+}
+
+//Subscription is closed when its events channel is full, subscriber reconnects and catches up from replay buffer
+type topicSubscription struct {
+	*closeSignal
+	//Subject to topic name
+	subjects map[BusSubject]string
+	events   chan realtimeEvent
+}
+
+type replayBuffer struct {
+	events    []realtimeEvent
+	updatedAt time.Time
+}
+
+//Keeps bounded replay buffer per subject of configured topics and notifies subscribers.
+//Buffer without subscribers is evicted after bufferTtl without events.
+//Event ids are sequential within gateway instance so they can be used as cursor,
+//they are prefixed by epoch of instance so cursor of other instance or previous run is recognized
+type topicHub struct {
+	mutex         sync.Mutex
+	epoch         string
+	lastId        uint64
+	replaySize    int
+	bufferTtl     time.Duration
+	topics        []BusSubject
+	buffers       map[BusSubject]*replayBuffer
+	subscriptions map[*topicSubscription]bool
+}
+
+func newTopicHub(replaySize int, stop <-chan struct{}) *topicHub {
+	hub := &topicHub{
+		epoch:         strconv.FormatInt(time.Now().UnixNano(), 36),
+		replaySize:    replaySize,
+		bufferTtl:     defaultBufferTtl,
+		buffers:       map[BusSubject]*replayBuffer{},
+		subscriptions: map[*topicSubscription]bool{},
+	}
+
+	go runEvery(time.Minute, hub.prune, stop)
+	return hub
+}
+
+//Subject of topic templated by userId matches any single token in place of template
+func matchTopicSubject(topic BusSubject, subject BusSubject) bool {
+	splittedTopic := strings.SplitN(string(topic), realtimeUserIdTemplate, 2)
+	if len(splittedTopic) == 1 {
+		return topic == subject
+	}
+
+	prefix, suffix := splittedTopic[0], splittedTopic[1]
+	if len(subject) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(string(subject), prefix) ||
+		!strings.HasSuffix(string(subject), suffix) {
+		return false
+	}
+
+	userId := string(subject)[len(prefix) : len(subject)-len(suffix)]
+	return !strings.ContainsAny(userId, ".*> ")
+}
+
+func (hub *topicHub) buffered(subject BusSubject) bool {
+	for _, topic := range hub.topics {
+		if matchTopicSubject(topic, subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (hub *topicHub) subscribed(subject BusSubject) bool {
+	for subscription := range hub.subscriptions {
+		if _, ok := subscription.subjects[subject]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (hub *topicHub) prune() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	now := time.Now()
+
+	for subject, buffer := range hub.buffers {
+		if now.Sub(buffer.updatedAt) > hub.bufferTtl && !hub.subscribed(subject) {
+			delete(hub.buffers, subject)
+		}
+	}
+}
+
+func (hub *topicHub) publish(subject BusSubject, method string, data json.RawMessage) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.lastId++
+
+	event := realtimeEvent{
+		id:      hub.lastId,
+		subject: subject,
+		method:  method,
+		data:    data,
+	}
+
+	//Subjects outside of configured topics can't be subscribed, so they are not buffered
+	if hub.replaySize > 0 && hub.buffered(subject) {
+		buffer, ok := hub.buffers[subject]
+		if !ok {
+			buffer = &replayBuffer{}
+			hub.buffers[subject] = buffer
+		}
+
+		buffer.events = append(buffer.events, event)
+		if len(buffer.events) > hub.replaySize {
+			buffer.events = buffer.events[len(buffer.events)-hub.replaySize:]
+		}
+
+		buffer.updatedAt = time.Now()
+	}
+
+	for subscription := range hub.subscriptions {
+		if _, ok := subscription.subjects[subject]; !ok {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.close()
+		}
+	}
+}
+
+//Returns buffered events after id ordered by id
+func (hub *topicHub) since(subjects map[BusSubject]string, lastId uint64) []realtimeEvent {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	events := []realtimeEvent{}
+
+	for subject := range subjects {
+		buffer, ok := hub.buffers[subject]
+		if !ok {
+			continue
+		}
+
+		for _, event := range buffer.events {
+			if event.id > lastId {
+				events = append(events, event)
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].id < events[j].id
+	})
+
+	return events
+}
+
+func (hub *topicHub) configure(topics map[string]BusSubject, replaySize int, bufferTtl time.Duration) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.topics = []BusSubject{}
+	for _, subject := range topics {
+		hub.topics = append(hub.topics, subject)
+	}
+
+	hub.replaySize = replaySize
+	hub.bufferTtl = bufferTtl
+}
+
+func (hub *topicHub) replays() bool {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return hub.replaySize > 0
+}
+
+func (hub *topicHub) currentId() uint64 {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	return hub.lastId
+}
+
+func (hub *topicHub) subscribe(subjects map[BusSubject]string, buffer int) *topicSubscription {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	subscription := &topicSubscription{
+		closeSignal: newCloseSignal(),
+		subjects:    subjects,
+		events:      make(chan realtimeEvent, buffer),
+	}
+
+	hub.subscriptions[subscription] = true
+	return subscription
+}
+
+func (hub *topicHub) unsubscribe(subscription *topicSubscription) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	delete(hub.subscriptions, subscription)
+}
+
+//Format: "orders:gateway.events.orders.{userId};news:gateway.events.news"
+func parseRealtimeTopics(rawTopics string) (map[string]BusSubject, error) {
+	topics := map[string]BusSubject{}
+
+	if rawTopics == "" {
+		return topics, nil
+	}
+
+	for _, rawTopic := range strings.Split(rawTopics, ";") {
+		splittedTopic := strings.Split(rawTopic, ":")
+
+		if len(splittedTopic) != 2 || splittedTopic[0] == "" {
+			return nil, fmt.Errorf("Wrong realtime topic format: %v\n", rawTopic)
+		}
+
+		subject := splittedTopic[1]
+		if !strings.HasPrefix(subject, realtimeSubjectPrefix) {
+			return nil, fmt.Errorf("Realtime topic subject must start with %v: %v\n", realtimeSubjectPrefix, subject)
+		}
+
+		topics[splittedTopic[0]] = BusSubject(subject)
+	}
+
+	return topics, nil
+}
+
+//Resolves requested topics to subjects of caller.
+//Topics templated by userId are available only to callers with userId
+func (h *Handler) authorizeTopics(identity *identity, rawTopics string) (map[BusSubject]string, error) {
+	if identity == nil {
+		return nil, &statusError{status: http.StatusUnauthorized, reason: "realtime topics require authentication"}
+	}
+
+	subjects := map[BusSubject]string{}
+
+	for _, topic := range strings.Split(rawTopics, ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			continue
+		}
+
+		subject, ok := h.realtimeTopics[topic]
+		if !ok {
+			return nil, &statusError{status: http.StatusNotFound, reason: "unknown topic " + topic}
+		}
+
+		if strings.Contains(string(subject), realtimeUserIdTemplate) {
+			if identity.userId == nil || *identity.userId == "" || strings.ContainsAny(*identity.userId, ".*> ") {
+				return nil, &statusError{status: http.StatusForbidden, reason: "topic " + topic + " requires user"}
+			}
+
+			subject = BusSubject(strings.Replace(string(subject), realtimeUserIdTemplate, *identity.userId, -1))
+		}
+
+		subjects[subject] = topic
+	}
+
+	if len(subjects) == 0 {
+		return nil, &statusError{status: http.StatusBadRequest, reason: "no topics"}
+	}
+
+	return subjects, nil
+}
+
+//Format: "epoch-id"
+func (hub *topicHub) formatEventId(id uint64) string {
+	return hub.epoch + "-" + strconv.FormatUint(id, 10)
+}
+
+//Id of other epoch or ahead of current events is not known to this instance,
+//zero is returned for it so everything in replay buffer is sent
+func (hub *topicHub) parseEventId(rawId string) uint64 {
+	splittedId := strings.SplitN(rawId, "-", 2)
+	if len(splittedId) != 2 || splittedId[0] != hub.epoch {
+		return 0
+	}
+
+	id, err := strconv.ParseUint(splittedId[1], 10, 64)
+	if err != nil || id > hub.currentId() {
+		return 0
+	}
+
+	return id
+}
+
+func (h *Handler) onRealtimeMessage(instance cube.Cube, channel cube.Channel, message cube.Message) {
+	data := json.RawMessage("null")
+
+	if message.Params != nil {
+		data = *message.Params
+	}
+
+	h.topics.publish(BusSubject(channel), message.Method, data)
+}
+
+func (h *Handler) initRealtime(cubeInstance cube.Cube) error {
+	topics, err := parseRealtimeTopics(cubeInstance.GetParam("realtimeTopics"))
+	if err != nil {
+		return err
+	}
+
+	h.realtimeTopics = topics
+
+	replaySize := defaultReplaySize
+
+	rawReplaySize := cubeInstance.GetParam("realtimeReplaySize")
+	if rawReplaySize != "" {
+		replaySize, err = strconv.Atoi(rawReplaySize)
+		if err != nil || replaySize < 0 {
+			return fmt.Errorf("Wrong realtime replay size: %v\n", rawReplaySize)
+		}
+	}
+
+	bufferTtl, err := getDurationMsParam(cubeInstance, "realtimeBufferTtlMs", defaultBufferTtl)
+	if err != nil {
+		return err
+	}
+
+	h.topics.configure(topics, replaySize, bufferTtl)
+	return nil
+}
@@ -0,0 +1,108 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTopicHubBuffersOnlyConfiguredTopics(t *testing.T) {
+	hub := newTopicHub(defaultReplaySize, newTestStop(t))
+	hub.configure(map[string]BusSubject{
+		"orders": "gateway.events.orders.{userId}",
+		"news":   "gateway.events.news",
+	}, 2, time.Minute)
+
+	data := json.RawMessage("null")
+
+	hub.publish("gateway.events.news", "created", data)
+	hub.publish("gateway.events.orders.user", "created", data)
+	hub.publish("gateway.events.orders.user.items", "created", data)
+	hub.publish("gateway.events.other", "created", data)
+
+	if len(hub.buffers) != 2 {
+		t.Fatalf("expected buffers of news and user orders, got %v", len(hub.buffers))
+	}
+
+	for i := 0; i < 3; i++ {
+		hub.publish("gateway.events.news", "created", data)
+	}
+
+	events := hub.since(map[BusSubject]string{"gateway.events.news": "news"}, 0)
+	if len(events) != 2 || events[1].id != hub.currentId() {
+		t.Fatalf("expected two last news events, got %v", events)
+	}
+}
+
+func TestTopicHubEvictsIdleBuffers(t *testing.T) {
+	hub := newTopicHub(defaultReplaySize, newTestStop(t))
+	hub.configure(map[string]BusSubject{
+		"orders": "gateway.events.orders.{userId}",
+	}, defaultReplaySize, time.Minute)
+
+	data := json.RawMessage("null")
+
+	hub.publish("gateway.events.orders.first", "created", data)
+	hub.publish("gateway.events.orders.second", "created", data)
+
+	subscription := hub.subscribe(map[BusSubject]string{"gateway.events.orders.second": "orders"}, 1)
+	defer hub.unsubscribe(subscription)
+
+	for _, buffer := range hub.buffers {
+		buffer.updatedAt = time.Now().Add(-2 * time.Minute)
+	}
+
+	hub.prune()
+
+	if _, ok := hub.buffers["gateway.events.orders.first"]; ok {
+		t.Fatal("expected idle buffer without subscribers to be evicted")
+	}
+
+	if _, ok := hub.buffers["gateway.events.orders.second"]; !ok {
+		t.Fatal("expected buffer with subscriber to be kept")
+	}
+}
+
+func TestTopicHubEventIdsOfOtherEpochReplayEverything(t *testing.T) {
+	hub := newTopicHub(defaultReplaySize, newTestStop(t))
+	hub.configure(map[string]BusSubject{"news": "gateway.events.news"}, defaultReplaySize, time.Minute)
+
+	hub.publish("gateway.events.news", "created", json.RawMessage("null"))
+	hub.publish("gateway.events.news", "created", json.RawMessage("null"))
+
+	if id := hub.parseEventId(hub.formatEventId(1)); id != 1 {
+		t.Fatalf("expected own event id to be parsed, got %v", id)
+	}
+
+	otherHub := newTopicHub(defaultReplaySize, newTestStop(t))
+	otherHub.epoch = "other"
+
+	for _, rawId := range []string{otherHub.formatEventId(1), hub.formatEventId(3), "1", "wrong"} {
+		if id := hub.parseEventId(rawId); id != 0 {
+			t.Errorf("expected unknown id %v to replay everything, got %v", rawId, id)
+		}
+	}
+}
+
+func TestTopicHubClosesOverflowedSubscription(t *testing.T) {
+	hub := newTopicHub(defaultReplaySize, newTestStop(t))
+
+	subscription := hub.subscribe(map[BusSubject]string{"gateway.events.news": "news"}, 1)
+	defer hub.unsubscribe(subscription)
+
+	hub.publish("gateway.events.news", "created", json.RawMessage("null"))
+
+	select {
+	case <-subscription.closed:
+		t.Fatal("expected subscription with free buffer to stay open")
+	default:
+	}
+
+	hub.publish("gateway.events.news", "created", json.RawMessage("null"))
+
+	select {
+	case <-subscription.closed:
+	default:
+		t.Fatal("expected subscription to be closed when event is dropped")
+	}
+}
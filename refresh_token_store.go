@@ -0,0 +1,263 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Used tokens are kept until expiration to detect reuse
+const refreshTokenPruneInterval = time.Minute
+
+//Refresh token stored by hash, tokens issued by rotation share family and its IssuedAt
+type refreshToken struct {
+	Hash      string                 `json:"hash"`
+	FamilyId  string                 `json:"familyId"`
+	UserId    string                 `json:"userId"`
+	DeviceId  string                 `json:"deviceId"`
+	Claims    map[string]interface{} `json:"claims"`
+	IssuedAt  time.Time              `json:"issuedAt"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+	Used      bool                   `json:"used"`
+	Revoked   bool                   `json:"revoked"`
+}
+
+type refreshTokenStore interface {
+	get(hash string) (*refreshToken, error)
+	save(token refreshToken) error
+	//Stores replacement in family of token and marks token as used in one step.
+	//Nothing is changed when token is unknown, used, revoked or expired. Returns token state before rotation
+	rotate(hash string, replacement refreshToken) (*refreshToken, error)
+	revokeFamily(familyId string) error
+	revokeDevice(userId string, deviceId string) error
+}
+
+type memoryRefreshTokenStore struct {
+	mutex  sync.Mutex
+	tokens map[string]refreshToken
+}
+
+func newMemoryRefreshTokenStore(stop <-chan struct{}) *memoryRefreshTokenStore {
+	store := &memoryRefreshTokenStore{
+		tokens: map[string]refreshToken{},
+	}
+
+	go runEvery(refreshTokenPruneInterval, store.prune, stop)
+	return store
+}
+
+func (s *memoryRefreshTokenStore) prune() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pruneExpired()
+}
+
+func (s *memoryRefreshTokenStore) get(hash string) (*refreshToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (s *memoryRefreshTokenStore) save(token refreshToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[token.Hash] = token
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) rotate(hash string, replacement refreshToken) (*refreshToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, _ := s.applyRotation(hash, replacement)
+	return token, nil
+}
+
+//Must be called with locked mutex, returns token before rotation and whether it is rotated
+func (s *memoryRefreshTokenStore) applyRotation(hash string, replacement refreshToken) (*refreshToken, bool) {
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, false
+	}
+
+	if token.Used || token.Revoked || time.Now().After(token.ExpiresAt) {
+		return &token, false
+	}
+
+	replacement.FamilyId = token.FamilyId
+	replacement.UserId = token.UserId
+	replacement.DeviceId = token.DeviceId
+	replacement.Claims = token.Claims
+	replacement.IssuedAt = token.IssuedAt
+	s.tokens[replacement.Hash] = replacement
+
+	usedToken := token
+	usedToken.Used = true
+	s.tokens[hash] = usedToken
+
+	return &token, true
+}
+
+func (s *memoryRefreshTokenStore) revokeFamily(familyId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.markFamilyRevoked(familyId)
+	return nil
+}
+
+func (s *memoryRefreshTokenStore) revokeDevice(userId string, deviceId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.markDeviceRevoked(userId, deviceId)
+	return nil
+}
+
+//Must be called with locked mutex
+func (s *memoryRefreshTokenStore) markDeviceRevoked(userId string, deviceId string) {
+	for hash, token := range s.tokens {
+		if token.UserId == userId && token.DeviceId == deviceId {
+			token.Revoked = true
+			s.tokens[hash] = token
+		}
+	}
+}
+
+//Must be called with locked mutex
+func (s *memoryRefreshTokenStore) markFamilyRevoked(familyId string) {
+	for hash, token := range s.tokens {
+		if token.FamilyId == familyId {
+			token.Revoked = true
+			s.tokens[hash] = token
+		}
+	}
+}
+
+//Must be called with locked mutex
+func (s *memoryRefreshTokenStore) pruneExpired() {
+	now := time.Now()
+
+	for hash, token := range s.tokens {
+		if token.ExpiresAt.Before(now) {
+			delete(s.tokens, hash)
+		}
+	}
+}
+
+//Keeps tokens in memory and rewrites json file on every change
+type fileRefreshTokenStore struct {
+	memoryRefreshTokenStore
+	path string
+}
+
+func newFileRefreshTokenStore(path string) (*fileRefreshTokenStore, error) {
+	store := &fileRefreshTokenStore{
+		path: path,
+	}
+	store.tokens = map[string]refreshToken{}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store.tokens)
+	if err != nil {
+		return nil, fmt.Errorf("wrong refresh tokens file: %v", err)
+	}
+
+	return store, nil
+}
+
+//Must be called with locked mutex
+func (s *fileRefreshTokenStore) persist() error {
+	s.pruneExpired()
+
+	data, err := json.Marshal(s.tokens)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *fileRefreshTokenStore) save(token refreshToken) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tokens[token.Hash] = token
+	return s.persist()
+}
+
+func (s *fileRefreshTokenStore) rotate(hash string, replacement refreshToken) (*refreshToken, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, rotated := s.applyRotation(hash, replacement)
+	if !rotated {
+		return token, nil
+	}
+
+	err := s.persist()
+	if err != nil {
+		//Token stays usable so retry of client is not taken for reuse
+		s.tokens[hash] = *token
+		delete(s.tokens, replacement.Hash)
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *fileRefreshTokenStore) revokeFamily(familyId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.markFamilyRevoked(familyId)
+	return s.persist()
+}
+
+func (s *fileRefreshTokenStore) revokeDevice(userId string, deviceId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.markDeviceRevoked(userId, deviceId)
+	return s.persist()
+}
+
+//Format: "memory" or "file:/path/to/tokens.json"
+func newRefreshTokenStore(rawStore string, stop <-chan struct{}) (refreshTokenStore, error) {
+	if rawStore == "memory" {
+		return newMemoryRefreshTokenStore(stop), nil
+	}
+
+	if strings.HasPrefix(rawStore, "file:") {
+		return newFileRefreshTokenStore(strings.TrimPrefix(rawStore, "file:"))
+	}
+
+	return nil, fmt.Errorf("Unknown refresh token store: %v\n", rawStore)
+}
@@ -0,0 +1,247 @@
+package cube_http_gateway
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	refreshRoute               = "/auth/refresh"
+	logoutRoute                = "/auth/logout"
+	defaultAuthEventsSubject   = "gateway.auth.events"
+	authEventRefresh           = "refresh"
+	authEventLogout            = "logout"
+	authEventRefreshTokenReuse = "refreshTokenReuse"
+)
+
+func newRandomToken() (string, error) {
+	data := make([]byte, 32)
+
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//Creates refresh token in family, new family is started for empty familyId
+func (h *Handler) createRefreshToken(familyId string, result *js.LoginResult) (string, error) {
+	value, err := newRandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if familyId == "" {
+		familyId = uuid.NewV4().String()
+	}
+
+	err = h.refreshTokens.save(refreshToken{
+		Hash:      hashToken(value),
+		FamilyId:  familyId,
+		UserId:    result.UserId,
+		DeviceId:  result.DeviceId,
+		Claims:    result.Claims,
+		IssuedAt:  time.Now(),
+		ExpiresAt: time.Now().Add(h.refreshTokenLifetime),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+func (h *Handler) publishAuthEvent(method string, token *refreshToken) {
+	packedParams, err := json.Marshal(js.AuthEvent{
+		UserId:   token.UserId,
+		DeviceId: token.DeviceId,
+		FamilyId: token.FamilyId,
+		Time:     time.Now().UnixNano(),
+	})
+
+	if err != nil {
+		return
+	}
+
+	err = h.cubeInstance.PublishMessage(cube.Channel(h.authEventsSubject), cube.Message{
+		Id:     uuid.NewV4().String(),
+		Method: method,
+		Params: (*json.RawMessage)(&packedParams),
+	})
+
+	if err != nil {
+		h.cubeInstance.LogError("Can't publish auth event: " + err.Error())
+	}
+}
+
+func readRefreshTokenRequest(request *http.Request) (string, bool) {
+	if request.Method != http.MethodPost || request.Body == nil {
+		return "", false
+	}
+
+	var params js.RefreshTokenParams
+
+	err := json.NewDecoder(request.Body).Decode(&params)
+	if err != nil || params.RefreshToken == "" {
+		return "", false
+	}
+
+	return params.RefreshToken, true
+}
+
+func (h *Handler) serveRefresh(writer http.ResponseWriter, request *http.Request) {
+	value, ok := readRefreshTokenRequest(request)
+	if !ok {
+		http.Error(writer,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest)
+		return
+	}
+
+	hash := hashToken(value)
+
+	token, err := h.refreshTokens.get(hash)
+	if err != nil {
+		h.cubeInstance.LogError("Can't get refresh token: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	if !h.checkRefreshToken(writer, token) {
+		return
+	}
+
+	//Everything which may fail is done before rotation, so failed refresh can be retried with the same token
+	response, err := h.newTokenResponse(&js.LoginResult{
+		UserId:   token.UserId,
+		DeviceId: token.DeviceId,
+		Claims:   token.Claims,
+	})
+
+	if err == nil {
+		response.RefreshToken, err = newRandomToken()
+	}
+
+	if err == nil {
+		token, err = h.refreshTokens.rotate(hash, refreshToken{
+			Hash:      hashToken(response.RefreshToken),
+			ExpiresAt: time.Now().Add(h.refreshTokenLifetime),
+		})
+	}
+
+	if err != nil {
+		h.cubeInstance.LogError("Can't rotate refresh token: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	//Token may be rotated by concurrent request
+	if !h.checkRefreshToken(writer, token) {
+		return
+	}
+
+	h.publishAuthEvent(authEventRefresh, token)
+	writeJson(writer, http.StatusOK, response)
+}
+
+//Answers with 401 and returns false when token can't be rotated
+func (h *Handler) checkRefreshToken(writer http.ResponseWriter, token *refreshToken) bool {
+	if token == nil || token.Revoked || time.Now().After(token.ExpiresAt) {
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return false
+	}
+
+	//Rotated token is presented again, it may be stolen so whole family is revoked
+	if token.Used {
+		err := h.refreshTokens.revokeFamily(token.FamilyId)
+		if err != nil {
+			h.cubeInstance.LogError("Can't revoke refresh token family: " + err.Error())
+		}
+
+		h.cubeInstance.LogWarning("Refresh token reuse, family is revoked: " + token.FamilyId)
+		h.publishAuthEvent(authEventRefreshTokenReuse, token)
+
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return false
+	}
+
+	err := h.checkRevocation(token.UserId, token.DeviceId, token.IssuedAt)
+	if err != nil {
+		writeStatusError(writer, err)
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) serveLogout(writer http.ResponseWriter, request *http.Request) {
+	value, ok := readRefreshTokenRequest(request)
+	if !ok {
+		http.Error(writer,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.refreshTokens.get(hashToken(value))
+	if err == nil && token != nil && !token.Revoked {
+		err = h.refreshTokens.revokeFamily(token.FamilyId)
+		if err == nil {
+			h.publishAuthEvent(authEventLogout, token)
+		}
+	}
+
+	if err != nil {
+		h.cubeInstance.LogError("Can't logout: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) initRefreshTokens(cubeInstance cube.Cube) error {
+	rawStore := cubeInstance.GetParam("refreshTokenStore")
+	if rawStore == "" {
+		return nil
+	}
+
+	store, err := newRefreshTokenStore(rawStore, h.stop)
+	if err != nil {
+		return err
+	}
+
+	h.refreshTokenLifetime, err = getDurationMsParam(cubeInstance, "refreshTokenLifetimeMs", 30*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	h.authEventsSubject = BusSubject(cubeInstance.GetParam("authEventsSubject"))
+	if h.authEventsSubject == "" {
+		h.authEventsSubject = defaultAuthEventsSubject
+	}
+
+	h.refreshTokens = store
+	h.addGatewayRoute(refreshRoute, h.serveRefresh)
+	h.addGatewayRoute(logoutRoute, h.serveLogout)
+	return nil
+}
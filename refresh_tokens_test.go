@@ -0,0 +1,83 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func newTestRefreshHandler(t *testing.T, store string) *Handler {
+	handler, _ := newTestHandler(t, map[string]string{
+		"loginSubject":      "login",
+		"refreshTokenStore": store,
+	})
+
+	return handler
+}
+
+func refreshTestToken(handler *Handler, value string) (int, string) {
+	request := httptest.NewRequest("POST", refreshRoute, strings.NewReader(`{"refreshToken": "`+value+`"}`))
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+
+	var response js.TokenResponse
+	json.Unmarshal(writer.Body.Bytes(), &response)
+
+	return writer.Code, response.RefreshToken
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	handler := newTestRefreshHandler(t, "memory")
+
+	value, err := handler.createRefreshToken("", &js.LoginResult{UserId: "user", DeviceId: "device"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, rotatedValue := refreshTestToken(handler, value)
+	if status != http.StatusOK || rotatedValue == "" {
+		t.Fatalf("expected rotated token, got %v", status)
+	}
+
+	status, _ = refreshTestToken(handler, value)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 on reuse, got %v", status)
+	}
+
+	status, _ = refreshTestToken(handler, rotatedValue)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("expected family to be revoked, got %v", status)
+	}
+}
+
+func TestFailedRotationCanBeRetried(t *testing.T) {
+	dir := t.TempDir()
+	handler := newTestRefreshHandler(t, "file:"+filepath.Join(dir, "tokens.json"))
+
+	value, err := handler.createRefreshToken("", &js.LoginResult{UserId: "user", DeviceId: "device"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := handler.refreshTokens.(*fileRefreshTokenStore)
+	validPath := store.path
+	store.path = filepath.Join(dir, "missing", "tokens.json")
+
+	status, _ := refreshTestToken(handler, value)
+	if status != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when store fails, got %v", status)
+	}
+
+	store.path = validPath
+
+	status, rotatedValue := refreshTestToken(handler, value)
+	if status != http.StatusOK || rotatedValue == "" {
+		t.Fatalf("expected retry to rotate token, got %v", status)
+	}
+}
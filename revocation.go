@@ -0,0 +1,250 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+const (
+	RevocationsChannel = "gateway.revocations"
+
+	revocationPruneInterval      = time.Minute
+	revocationSnapshotRetryDelay = 5 * time.Second
+)
+
+type revocationEntry struct {
+	issuedBefore int64
+	expiresAt    int64
+}
+
+//Revoked jti, userId and deviceId values until their expiration, zero expiration is permanent.
+//Device revocations are keyed by userId and deviceId, bare deviceId revokes device of every user.
+//Revocations of the same key are merged, so snapshot can't weaken revocation received while it was loading.
+//List is not loaded while snapshot subject is configured and snapshot is not received yet
+type revocationList struct {
+	mutex     sync.RWMutex
+	loaded    bool
+	jtis      map[string]revocationEntry
+	userIds   map[string]revocationEntry
+	deviceIds map[string]revocationEntry
+}
+
+func newRevocationList(stop <-chan struct{}) *revocationList {
+	list := &revocationList{
+		loaded:    true,
+		jtis:      map[string]revocationEntry{},
+		userIds:   map[string]revocationEntry{},
+		deviceIds: map[string]revocationEntry{},
+	}
+
+	go runEvery(revocationPruneInterval, list.prune, stop)
+	return list
+}
+
+func (l *revocationList) setLoaded(loaded bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.loaded = loaded
+}
+
+func (l *revocationList) isLoaded() bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	return l.loaded
+}
+
+func (l *revocationList) prune() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now().Unix()
+
+	pruneRevocations(l.jtis, now)
+	pruneRevocations(l.userIds, now)
+	pruneRevocations(l.deviceIds, now)
+}
+
+func deviceRevocationKey(userId string, deviceId string) string {
+	return userId + "\n" + deviceId
+}
+
+//Stronger of two revocations is kept, zero issuedBefore and zero expiresAt are the strongest
+func mergeRevocation(entries map[string]revocationEntry, key string, entry revocationEntry, now int64) {
+	existing, ok := entries[key]
+	if ok && (existing.expiresAt == 0 || existing.expiresAt > now) {
+		if existing.issuedBefore == 0 || (entry.issuedBefore != 0 && existing.issuedBefore > entry.issuedBefore) {
+			entry.issuedBefore = existing.issuedBefore
+		}
+
+		if existing.expiresAt == 0 || (entry.expiresAt != 0 && existing.expiresAt > entry.expiresAt) {
+			entry.expiresAt = existing.expiresAt
+		}
+	}
+
+	entries[key] = entry
+}
+
+func pruneRevocations(entries map[string]revocationEntry, now int64) {
+	for key, entry := range entries {
+		if entry.expiresAt != 0 && entry.expiresAt <= now {
+			delete(entries, key)
+		}
+	}
+}
+
+//Returns number of skipped revocations which are already expired
+func (l *revocationList) add(revocations []js.Revocation) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now().Unix()
+	expired := 0
+
+	for _, revocation := range revocations {
+		if revocation.ExpiresAt != 0 && revocation.ExpiresAt <= now {
+			expired++
+			continue
+		}
+
+		entry := revocationEntry{
+			issuedBefore: revocation.IssuedBefore,
+			expiresAt:    revocation.ExpiresAt,
+		}
+
+		if revocation.Jti != nil {
+			mergeRevocation(l.jtis, *revocation.Jti, entry, now)
+		}
+
+		switch {
+		case revocation.UserId != nil && revocation.DeviceId != nil:
+			mergeRevocation(l.deviceIds, deviceRevocationKey(*revocation.UserId, *revocation.DeviceId), entry, now)
+		case revocation.UserId != nil:
+			mergeRevocation(l.userIds, *revocation.UserId, entry, now)
+		case revocation.DeviceId != nil:
+			mergeRevocation(l.deviceIds, deviceRevocationKey("", *revocation.DeviceId), entry, now)
+		}
+	}
+
+	return expired
+}
+
+func isRevokedBy(entries map[string]revocationEntry, key string, issuedAt int64, now int64) bool {
+	entry, ok := entries[key]
+	if !ok || (entry.expiresAt != 0 && entry.expiresAt <= now) {
+		return false
+	}
+
+	return entry.issuedBefore == 0 || issuedAt < entry.issuedBefore
+}
+
+func (l *revocationList) isRevoked(jti string, userId string, deviceId string, issuedAt int64) bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	now := time.Now().Unix()
+
+	return (jti != "" && isRevokedBy(l.jtis, jti, issuedAt, now)) ||
+		isRevokedBy(l.userIds, userId, issuedAt, now) ||
+		isRevokedBy(l.deviceIds, deviceRevocationKey(userId, deviceId), issuedAt, now) ||
+		isRevokedBy(l.deviceIds, deviceRevocationKey("", deviceId), issuedAt, now)
+}
+
+func (h *Handler) onRevocationMessage(instance cube.Cube, message cube.Message) {
+	if message.Params == nil {
+		return
+	}
+
+	var revocation js.Revocation
+
+	err := json.Unmarshal(*message.Params, &revocation)
+	if err != nil {
+		instance.LogError("Wrong revocation message: " + err.Error())
+		return
+	}
+
+	if h.revocations.add([]js.Revocation{revocation}) > 0 {
+		instance.LogWarning("Expired revocation is skipped")
+	}
+}
+
+//Checks user and device of identity which isn't a token, like refresh token family or session
+func (h *Handler) checkRevocation(userId string, deviceId string, issuedAt time.Time) error {
+	if !h.revocations.isLoaded() {
+		return &statusError{status: http.StatusServiceUnavailable, reason: "revocations are not loaded"}
+	}
+
+	if h.revocations.isRevoked("", userId, deviceId, issuedAt.Unix()) {
+		return &statusError{status: http.StatusUnauthorized, reason: "credentials are revoked"}
+	}
+
+	return nil
+}
+
+//Merges snapshot into revocation list
+func (h *Handler) loadRevocationsSnapshot(cubeInstance cube.Cube, subject BusSubject) error {
+	timeout := time.Duration(h.timeoutMs) * time.Millisecond
+
+	response, err := cubeInstance.CallMethod(cube.Channel(subject), cube.Request{Method: "snapshot"}, timeout)
+	if err != nil {
+		return err
+	}
+
+	if response.Error != nil {
+		return fmt.Errorf("%v: %v", response.Error.Name, response.Error.Message)
+	}
+
+	if response.Result == nil {
+		return nil
+	}
+
+	var revocations []js.Revocation
+
+	err = json.Unmarshal(*response.Result, &revocations)
+	if err != nil {
+		return err
+	}
+
+	expired := h.revocations.add(revocations)
+	if expired > 0 {
+		cubeInstance.LogWarning(fmt.Sprintf("%v expired revocations of snapshot are skipped", expired))
+	}
+
+	h.revocations.setLoaded(true)
+	return nil
+}
+
+//Snapshot is loaded in background and retried until it succeeds, tokens are rejected with 503 till then
+func (h *Handler) initRevocations(cubeInstance cube.Cube) {
+	subject := BusSubject(cubeInstance.GetParam("revocationSnapshotSubject"))
+	if subject == "" {
+		return
+	}
+
+	h.revocations.setLoaded(false)
+
+	go func() {
+		for {
+			err := h.loadRevocationsSnapshot(cubeInstance, subject)
+			if err == nil {
+				return
+			}
+
+			fmt.Println("Can't load revocations snapshot", err)
+			cubeInstance.LogError("Can't load revocations snapshot: " + err.Error())
+
+			select {
+			case <-time.After(revocationSnapshotRetryDelay):
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,164 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+func TestRevocationExpiration(t *testing.T) {
+	list := newRevocationList(newTestStop(t))
+
+	permanent := "permanent"
+	expired := "expired"
+	now := time.Now()
+
+	skipped := list.add([]js.Revocation{
+		{Jti: &permanent},
+		{Jti: &expired, ExpiresAt: now.Add(-time.Minute).Unix()},
+	})
+
+	if skipped != 1 {
+		t.Fatalf("expected expired revocation to be skipped, got %v", skipped)
+	}
+
+	list.prune()
+
+	if !list.isRevoked(permanent, "user", "device", now.Unix()) {
+		t.Fatal("expected revocation without expiration to be permanent")
+	}
+
+	if list.isRevoked(expired, "user", "device", now.Unix()) {
+		t.Fatal("expected expired revocation to be ignored")
+	}
+}
+
+func TestTokensAreRejectedUntilRevocationsAreLoaded(t *testing.T) {
+	var snapshotReady atomic.Bool
+
+	handler, fake := newTestHandler(t, nil)
+
+	fake.params["revocationSnapshotSubject"] = "revocations"
+	fake.call = func(channel cube.Channel, request cube.Request) (*cube.Response, error) {
+		if channel != "revocations" {
+			return echoChannelCall(channel, request)
+		}
+
+		if !snapshotReady.Load() {
+			return nil, errors.New("snapshot is not available")
+		}
+
+		result := json.RawMessage("[]")
+		response := cube.NewResultResponse("", &result)
+		return &response, nil
+	}
+
+	handler.initRevocations(fake)
+
+	if handler.revocations.isLoaded() {
+		t.Fatal("expected revocations not to be loaded")
+	}
+
+	token := newTestToken(t, handler, "user")
+
+	serve := func() int {
+		request := httptest.NewRequest("GET", "/orders", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+
+		writer := httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+		return writer.Code
+	}
+
+	if status := serve(); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 before snapshot is loaded, got %v", status)
+	}
+
+	snapshotReady.Store(true)
+
+	err := handler.loadRevocationsSnapshot(fake, "revocations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := serve(); status != http.StatusOK {
+		t.Fatalf("expected 200 after snapshot is loaded, got %v", status)
+	}
+}
+
+func TestUserDeviceRevocationIsScopedToUser(t *testing.T) {
+	list := newRevocationList(newTestStop(t))
+
+	userId := "user"
+	deviceId := "phone"
+	issuedAt := time.Now().Unix()
+
+	list.add([]js.Revocation{{UserId: &userId, DeviceId: &deviceId}})
+
+	if !list.isRevoked("", userId, deviceId, issuedAt) {
+		t.Fatal("expected device of user to be revoked")
+	}
+
+	if list.isRevoked("", userId, "laptop", issuedAt) {
+		t.Fatal("expected other device of user to stay valid")
+	}
+
+	if list.isRevoked("", "other", deviceId, issuedAt) {
+		t.Fatal("expected device with the same id of other user to stay valid")
+	}
+}
+
+func TestSnapshotDoesNotWeakenLiveRevocation(t *testing.T) {
+	list := newRevocationList(newTestStop(t))
+
+	userId := "user"
+	now := time.Now()
+
+	//Received from bus while snapshot was loading
+	list.add([]js.Revocation{{UserId: &userId, IssuedBefore: now.Unix()}})
+
+	list.add([]js.Revocation{{
+		UserId:       &userId,
+		IssuedBefore: now.Add(-time.Hour).Unix(),
+		ExpiresAt:    now.Add(time.Minute).Unix(),
+	}})
+
+	entry := list.userIds[userId]
+	if entry.issuedBefore != now.Unix() || entry.expiresAt != 0 {
+		t.Fatalf("expected live revocation to be kept, got %+v", entry)
+	}
+}
+
+func TestRefreshAndSessionAreCheckedAgainstRevocations(t *testing.T) {
+	handler := newTestRefreshHandler(t, "memory")
+
+	value, err := handler.createRefreshToken("", &js.LoginResult{UserId: "user", DeviceId: "device"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userId := "user"
+	handler.revocations.add([]js.Revocation{{UserId: &userId, IssuedBefore: time.Now().Unix() + 1}})
+
+	if status, _ := refreshTestToken(handler, value); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for refresh token of revoked user, got %v", status)
+	}
+
+	if err := handler.checkRevocation("user", "device", time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("expected session created after revocation to stay valid, got %v", err)
+	}
+
+	handler.revocations.setLoaded(false)
+
+	err = handler.checkRevocation("other", "device", time.Now())
+	if statusErr, ok := err.(*statusError); !ok || statusErr.status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 until revocations are loaded, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+	"strings"
+)
+
+func parseUriList(rawList string) []Uri {
+	if rawList == "" {
+		return nil
+	}
+
+	uris := []Uri{}
+
+	for _, rawUri := range strings.Split(rawList, ";") {
+		rawUri = strings.TrimSpace(rawUri)
+		if rawUri == "" {
+			continue
+		}
+
+		uris = append(uris, Uri(rawUri))
+	}
+
+	return uris
+}
+
+//Pattern ending with "*" matches every uri with the same prefix
+func matchUri(pattern Uri, uri Uri) bool {
+	if strings.HasSuffix(string(pattern), "*") {
+		return strings.HasPrefix(string(uri), strings.TrimSuffix(string(pattern), "*"))
+	}
+
+	return pattern == uri
+}
+
+func matchAnyUri(patterns []Uri, uri Uri) bool {
+	for _, pattern := range patterns {
+		if matchUri(pattern, uri) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseSubjectList(rawList string) []BusSubject {
+	subjects := []BusSubject{}
+
+	for _, uri := range parseUriList(rawList) {
+		subjects = append(subjects, BusSubject(uri))
+	}
+
+	return subjects
+}
+
+//Subject patterns follow the same "*" suffix rule as uri patterns
+func matchAnySubject(patterns []BusSubject, subject BusSubject) bool {
+	for _, pattern := range patterns {
+		if matchUri(Uri(pattern), Uri(subject)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func requestPath(request *http.Request) Uri {
+	return Uri(request.URL.Path)
+}
+
+//Route served by gateway itself instead of bus subject
+type gatewayRoute struct {
+	pattern Uri
+	handler http.HandlerFunc
+}
+
+func (h *Handler) addGatewayRoute(pattern Uri, handler http.HandlerFunc) {
+	h.gatewayRoutes = append(h.gatewayRoutes, gatewayRoute{
+		pattern: pattern,
+		handler: handler,
+	})
+}
+
+func (h *Handler) findGatewayRoute(path Uri) *gatewayRoute {
+	for i := range h.gatewayRoutes {
+		if matchUri(h.gatewayRoutes[i].pattern, path) {
+			return &h.gatewayRoutes[i]
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) serveGatewayRoute(writer http.ResponseWriter, request *http.Request) bool {
+	route := h.findGatewayRoute(requestPath(request))
+	if route == nil {
+		return false
+	}
+
+	route.handler(writer, request)
+	return true
+}
@@ -0,0 +1,233 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Session stored by hash of session id
+type session struct {
+	Hash      string                 `json:"hash"`
+	UserId    string                 `json:"userId"`
+	DeviceId  string                 `json:"deviceId"`
+	Claims    map[string]interface{} `json:"claims"`
+	CreatedAt time.Time              `json:"createdAt"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+}
+
+type sessionStore interface {
+	get(hash string) (*session, error)
+	save(session session) error
+	delete(hash string) error
+	//Extends session only if it still exists, so extension can't bring back deleted session
+	touch(hash string, expiresAt time.Time) (bool, error)
+	//Deletes every session of user device
+	deleteDevice(userId string, deviceId string) error
+}
+
+type memorySessionStore struct {
+	mutex    sync.Mutex
+	sessions map[string]session
+}
+
+const sessionPruneInterval = time.Minute
+
+func newMemorySessionStore(stop <-chan struct{}) *memorySessionStore {
+	store := &memorySessionStore{
+		sessions: map[string]session{},
+	}
+
+	go runEvery(sessionPruneInterval, store.prune, stop)
+	return store
+}
+
+func (s *memorySessionStore) prune() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pruneExpired()
+}
+
+func (s *memorySessionStore) get(hash string) (*session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session, ok := s.sessions[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	return &session, nil
+}
+
+func (s *memorySessionStore) save(session session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions[session.Hash] = session
+	return nil
+}
+
+func (s *memorySessionStore) delete(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, hash)
+	return nil
+}
+
+func (s *memorySessionStore) touch(hash string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.extend(hash, expiresAt), nil
+}
+
+func (s *memorySessionStore) deleteDevice(userId string, deviceId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.removeDevice(userId, deviceId)
+	return nil
+}
+
+//Must be called with locked mutex, returns true if any session is removed
+func (s *memorySessionStore) removeDevice(userId string, deviceId string) bool {
+	removed := false
+
+	for hash, session := range s.sessions {
+		if session.UserId == userId && session.DeviceId == deviceId {
+			delete(s.sessions, hash)
+			removed = true
+		}
+	}
+
+	return removed
+}
+
+//Must be called with locked mutex
+func (s *memorySessionStore) extend(hash string, expiresAt time.Time) bool {
+	session, ok := s.sessions[hash]
+	if !ok {
+		return false
+	}
+
+	session.ExpiresAt = expiresAt
+	s.sessions[hash] = session
+	return true
+}
+
+//Must be called with locked mutex
+func (s *memorySessionStore) pruneExpired() {
+	now := time.Now()
+
+	for hash, session := range s.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(s.sessions, hash)
+		}
+	}
+}
+
+//Keeps sessions in memory and rewrites json file on every change
+type fileSessionStore struct {
+	memorySessionStore
+	path string
+}
+
+func newFileSessionStore(path string) (*fileSessionStore, error) {
+	store := &fileSessionStore{
+		path: path,
+	}
+	store.sessions = map[string]session{}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &store.sessions)
+	if err != nil {
+		return nil, fmt.Errorf("wrong sessions file: %v", err)
+	}
+
+	return store, nil
+}
+
+//Must be called with locked mutex
+func (s *fileSessionStore) persist() error {
+	s.pruneExpired()
+
+	data, err := json.Marshal(s.sessions)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+
+	err = ioutil.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+func (s *fileSessionStore) save(session session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions[session.Hash] = session
+	return s.persist()
+}
+
+func (s *fileSessionStore) delete(hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.sessions, hash)
+	return s.persist()
+}
+
+func (s *fileSessionStore) touch(hash string, expiresAt time.Time) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.extend(hash, expiresAt) {
+		return false, nil
+	}
+
+	return true, s.persist()
+}
+
+func (s *fileSessionStore) deleteDevice(userId string, deviceId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.removeDevice(userId, deviceId) {
+		return nil
+	}
+
+	return s.persist()
+}
+
+//Format: "memory" or "file:/path/to/sessions.json"
+func newSessionStore(rawStore string, stop <-chan struct{}) (sessionStore, error) {
+	if rawStore == "memory" {
+		return newMemorySessionStore(stop), nil
+	}
+
+	if strings.HasPrefix(rawStore, "file:") {
+		return newFileSessionStore(strings.TrimPrefix(rawStore, "file:"))
+	}
+
+	return nil, fmt.Errorf("Unknown session store: %v\n", rawStore)
+}
@@ -0,0 +1,39 @@
+package cube_http_gateway
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemorySessionStorePrunesExpiredSessions(t *testing.T) {
+	store := newMemorySessionStore(newTestStop(t))
+
+	store.save(session{Hash: "expired", ExpiresAt: time.Now().Add(-time.Second)})
+	store.save(session{Hash: "active", ExpiresAt: time.Now().Add(time.Hour)})
+
+	store.prune()
+
+	if expired, _ := store.get("expired"); expired != nil {
+		t.Fatal("expected expired session to be pruned")
+	}
+
+	if active, _ := store.get("active"); active == nil {
+		t.Fatal("expected active session to be kept")
+	}
+}
+
+func TestMemorySessionStoreTouchKeepsDeletedSessionDeleted(t *testing.T) {
+	store := newMemorySessionStore(newTestStop(t))
+
+	store.save(session{Hash: "session", ExpiresAt: time.Now().Add(time.Minute)})
+	store.delete("session")
+
+	extended, err := store.touch("session", time.Now().Add(time.Hour))
+	if err != nil || extended {
+		t.Fatalf("expected deleted session not to be extended, got %v %v", extended, err)
+	}
+
+	if deleted, _ := store.get("session"); deleted != nil {
+		t.Fatal("expected touch not to bring back deleted session")
+	}
+}
@@ -0,0 +1,213 @@
+package cube_http_gateway
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+)
+
+const (
+	sessionRoute         = "/auth/session"
+	sessionLogoutRoute   = "/auth/session/logout"
+	defaultSessionCookie = "session_id"
+)
+
+//Cookie sessions with sliding expiration
+type sessionAuthenticator struct {
+	handler    *Handler
+	store      sessionStore
+	cookieName string
+	ttl        time.Duration
+}
+
+func (a *sessionAuthenticator) sessionCookie(request *http.Request) string {
+	cookie, err := request.Cookie(a.cookieName)
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+//Cookie lives as long as session, negative maxAge deletes it
+func (a *sessionAuthenticator) newCookie(request *http.Request, value string, expiresAt time.Time) *http.Cookie {
+	maxAge := int(time.Until(expiresAt) / time.Second)
+	if maxAge <= 0 {
+		maxAge = -1
+	}
+
+	return &http.Cookie{
+		Name:     a.cookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (a *sessionAuthenticator) authenticate(request *http.Request) (*identity, error) {
+	sessionId := a.sessionCookie(request)
+	if sessionId == "" {
+		return nil, nil
+	}
+
+	session, err := a.store.get(hashToken(sessionId))
+	if err != nil {
+		return nil, &statusError{status: http.StatusServiceUnavailable, reason: "session store error: " + err.Error()}
+	}
+
+	now := time.Now()
+
+	if session == nil || now.After(session.ExpiresAt) {
+		return nil, fmt.Errorf("session is expired")
+	}
+
+	err = a.handler.checkRevocation(session.UserId, session.DeviceId, session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionIdentity := &identity{
+		method:      authMethodSession,
+		userId:      &session.UserId,
+		deviceId:    &session.DeviceId,
+		tokenSource: tokenSourceCookie,
+	}
+
+	//Session is extended when less than half of ttl is left to spare store writes
+	if session.ExpiresAt.Sub(now) < a.ttl/2 {
+		expiresAt := now.Add(a.ttl)
+
+		//Session deleted by concurrent logout is not extended
+		extended, err := a.store.touch(session.Hash, expiresAt)
+		if err != nil {
+			a.handler.cubeInstance.LogError("Can't extend session: " + err.Error())
+		}
+
+		if extended {
+			sessionIdentity.cookie = a.newCookie(request, sessionId, expiresAt)
+		}
+	}
+
+	return sessionIdentity, nil
+}
+
+func (a *sessionAuthenticator) serveLogin(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := a.handler.callLoginSubject(request)
+	if err != nil {
+		a.handler.cubeInstance.LogError("Session login failed: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusBadGateway),
+			http.StatusBadGateway)
+		return
+	}
+
+	if result == nil {
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(a.ttl)
+
+	sessionId, err := newRandomToken()
+	if err == nil {
+		err = a.store.save(session{
+			Hash:      hashToken(sessionId),
+			UserId:    result.UserId,
+			DeviceId:  result.DeviceId,
+			Claims:    result.Claims,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		})
+	}
+
+	if err != nil {
+		a.handler.cubeInstance.LogError("Can't create session: " + err.Error())
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(writer, a.newCookie(request, sessionId, expiresAt))
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (a *sessionAuthenticator) serveLogout(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionId := a.sessionCookie(request)
+	if sessionId != "" {
+		err := a.store.delete(hashToken(sessionId))
+		if err != nil {
+			a.handler.cubeInstance.LogError("Can't delete session: " + err.Error())
+			http.Error(writer,
+				http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(writer, a.newCookie(request, "", time.Unix(0, 0)))
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) newSessionAuthenticator(cubeInstance cube.Cube) (*sessionAuthenticator, error) {
+	rawStore := cubeInstance.GetParam("sessionStore")
+	if rawStore == "" {
+		return nil, nil
+	}
+
+	if h.loginSubject == "" {
+		return nil, fmt.Errorf("login subject is required for sessions")
+	}
+
+	store, err := newSessionStore(rawStore, h.stop)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl, err := getDurationMsParam(cubeInstance, "sessionTtlMs", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cookieName := cubeInstance.GetParam("sessionCookie")
+	if cookieName == "" {
+		cookieName = defaultSessionCookie
+	}
+
+	authenticator := &sessionAuthenticator{
+		handler:    h,
+		store:      store,
+		cookieName: cookieName,
+		ttl:        ttl,
+	}
+
+	h.sessions = store
+
+	h.addGatewayRoute(sessionLogoutRoute, authenticator.serveLogout)
+	h.addGatewayRoute(sessionRoute, authenticator.serveLogin)
+
+	return authenticator, nil
+}
@@ -0,0 +1,84 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestSessionAuthenticator(t *testing.T, expiresIn time.Duration) (*sessionAuthenticator, *http.Request) {
+	handler, _ := newTestHandler(t, nil)
+
+	authenticator := &sessionAuthenticator{
+		handler:    handler,
+		store:      newMemorySessionStore(newTestStop(t)),
+		cookieName: defaultSessionCookie,
+		ttl:        time.Hour,
+	}
+
+	authenticator.store.save(session{
+		Hash:      hashToken("session-id"),
+		UserId:    "user",
+		DeviceId:  "device",
+		ExpiresAt: time.Now().Add(expiresIn),
+	})
+
+	request := httptest.NewRequest("GET", "/orders", nil)
+	request.AddCookie(&http.Cookie{Name: defaultSessionCookie, Value: "session-id"})
+
+	return authenticator, request
+}
+
+func TestSessionIsExtendedWhenHalfOfTtlIsLeft(t *testing.T) {
+	authenticator, request := newTestSessionAuthenticator(t, 20*time.Minute)
+
+	identity, err := authenticator.authenticate(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.cookie == nil || identity.cookie.MaxAge < int((59*time.Minute)/time.Second) {
+		t.Fatalf("expected refreshed cookie living for ttl, got %+v", identity.cookie)
+	}
+
+	stored, _ := authenticator.store.get(hashToken("session-id"))
+	if time.Until(stored.ExpiresAt) < 59*time.Minute {
+		t.Fatalf("expected session to be extended, expires in %v", time.Until(stored.ExpiresAt))
+	}
+}
+
+func TestSessionIsNotExtendedBeforeHalfOfTtl(t *testing.T) {
+	authenticator, request := newTestSessionAuthenticator(t, 40*time.Minute)
+
+	identity, err := authenticator.authenticate(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.cookie != nil {
+		t.Fatal("expected no cookie refresh")
+	}
+
+	stored, _ := authenticator.store.get(hashToken("session-id"))
+	if time.Until(stored.ExpiresAt) > 41*time.Minute {
+		t.Fatal("expected session not to be extended")
+	}
+}
+
+func TestSessionLogoutExpiresCookie(t *testing.T) {
+	authenticator, request := newTestSessionAuthenticator(t, time.Hour)
+	request.Method = http.MethodPost
+
+	writer := httptest.NewRecorder()
+	authenticator.serveLogout(writer, request)
+
+	cookies := writer.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Fatalf("expected expired cookie, got %+v", cookies)
+	}
+
+	if stored, _ := authenticator.store.get(hashToken("session-id")); stored != nil {
+		t.Fatal("expected session to be deleted")
+	}
+}
@@ -0,0 +1,141 @@
+package cube_http_gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+)
+
+const (
+	SignUrlChannel = "gateway.signUrl"
+
+	//Params are namespaced so query params of backends are not taken for signed url
+	signedUrlSignatureParam = "gw_signature"
+	signedUrlExpiresParam   = "gw_expires"
+	signedUrlUserIdParam    = "gw_uid"
+)
+
+//Signs path and canonical query: every param except signature, sorted by name
+func signedUrlSignature(secret string, path string, query url.Values) string {
+	signedQuery := url.Values{}
+	for name, values := range query {
+		if name != signedUrlSignatureParam {
+			signedQuery[name] = values
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + signedQuery.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//Returns path with query signature valid for GET and HEAD until expiresAt, userId is optional.
+//Query params of path are signed too
+func SignUrl(secret string, path string, expiresAt time.Time, userId string) (string, error) {
+	parsedUrl, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := parsedUrl.Query()
+	query.Set(signedUrlExpiresParam, expires)
+
+	if userId != "" {
+		query.Set(signedUrlUserIdParam, userId)
+	}
+
+	query.Set(signedUrlSignatureParam, signedUrlSignature(secret, parsedUrl.Path, query))
+	parsedUrl.RawQuery = query.Encode()
+
+	return parsedUrl.String(), nil
+}
+
+type signedUrlAuthenticator struct {
+	secret string
+}
+
+func (a *signedUrlAuthenticator) authenticate(request *http.Request) (*identity, error) {
+	query := request.URL.Query()
+
+	signature := query.Get(signedUrlSignatureParam)
+	if signature == "" {
+		return nil, nil
+	}
+
+	//Signed url gives read access only
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return nil, &statusError{status: http.StatusMethodNotAllowed, reason: "signed url allows only GET and HEAD"}
+	}
+
+	expires := query.Get(signedUrlExpiresParam)
+	userId := query.Get(signedUrlUserIdParam)
+
+	expectedSignature := signedUrlSignature(a.secret, request.URL.Path, query)
+	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+		return nil, fmt.Errorf("wrong url signature")
+	}
+
+	unixTime, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unixTime {
+		return nil, &statusError{status: http.StatusGone, reason: "signed url is expired"}
+	}
+
+	stripQueryParam(request, signedUrlSignatureParam)
+	stripQueryParam(request, signedUrlExpiresParam)
+	stripQueryParam(request, signedUrlUserIdParam)
+
+	identity := &identity{
+		method: authMethodSignedUrl,
+	}
+
+	if userId != "" {
+		identity.userId = &userId
+	}
+
+	return identity, nil
+}
+
+func (h *Handler) onSignUrlRequest(request cube.Request) cube.Response {
+	if h.signedUrlSecret == "" {
+		return cube.NewErrorResponse("", "NotConfigured", "signed url secret is not set")
+	}
+
+	if request.Params == nil {
+		return cube.NewErrorResponse("", "WrongParams", "params are required")
+	}
+
+	var params js.SignUrlParams
+
+	err := json.Unmarshal(*request.Params, &params)
+	if err != nil || params.Path == "" || params.ExpiresAt == 0 {
+		return cube.NewErrorResponse("", "WrongParams", "path and expiresAt are required")
+	}
+
+	userId := ""
+	if params.UserId != nil {
+		userId = *params.UserId
+	}
+
+	signedUrl, err := SignUrl(h.signedUrlSecret, params.Path, time.Unix(params.ExpiresAt, 0), userId)
+	if err != nil {
+		return cube.NewErrorResponse("", "WrongParams", err.Error())
+	}
+
+	packedResult, err := json.Marshal(js.SignUrlResult{Url: signedUrl})
+	if err != nil {
+		return cube.NewErrorResponse("", "InternalError", err.Error())
+	}
+
+	return cube.NewResultResponse("", (*json.RawMessage)(&packedResult))
+}
@@ -0,0 +1,74 @@
+package cube_http_gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedUrlAuthentication(t *testing.T) {
+	validUrl, _ := SignUrl("secret", "/orders?page=1", time.Now().Add(time.Hour), "user")
+	expiredUrl, _ := SignUrl("secret", "/orders", time.Now().Add(-time.Hour), "")
+	otherSecretUrl, _ := SignUrl("other", "/orders", time.Now().Add(time.Hour), "")
+	changedParamUrl := strings.Replace(validUrl, "page=1", "page=2", 1)
+	addedParamUrl := validUrl + "&admin=1"
+	changedUserUrl := strings.Replace(validUrl, signedUrlUserIdParam+"=user", signedUrlUserIdParam+"=admin", 1)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+		userId string
+		skip   bool
+	}{
+		{name: "valid get", method: "GET", url: validUrl, userId: "user"},
+		{name: "valid head", method: "HEAD", url: validUrl, userId: "user"},
+		{name: "post is refused", method: "POST", url: validUrl, status: http.StatusMethodNotAllowed},
+		{name: "expired", method: "GET", url: expiredUrl, status: http.StatusGone},
+		{name: "wrong secret", method: "GET", url: otherSecretUrl, status: http.StatusUnauthorized},
+		{name: "changed param", method: "GET", url: changedParamUrl, status: http.StatusUnauthorized},
+		{name: "added param", method: "GET", url: addedParamUrl, status: http.StatusUnauthorized},
+		{name: "changed user", method: "GET", url: changedUserUrl, status: http.StatusUnauthorized},
+		{name: "backend signature param is ignored", method: "POST", url: "/orders?signature=abc", skip: true},
+	}
+
+	authenticator := &signedUrlAuthenticator{secret: "secret"}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.url, nil)
+
+			identity, err := authenticator.authenticate(request)
+
+			if test.skip {
+				if identity != nil || err != nil {
+					t.Fatalf("expected request to be left to other authenticators, got %v %v", identity, err)
+				}
+				return
+			}
+
+			if test.status != 0 {
+				status := http.StatusUnauthorized
+				if statusErr, ok := err.(*statusError); ok {
+					status = statusErr.status
+				}
+
+				if err == nil || status != test.status {
+					t.Fatalf("expected status %v, got %v (%v)", test.status, status, err)
+				}
+				return
+			}
+
+			if err != nil || identity == nil || identity.userId == nil || *identity.userId != test.userId {
+				t.Fatalf("expected identity of %v, got %v %v", test.userId, identity, err)
+			}
+
+			if request.URL.RawQuery != "page=1" {
+				t.Fatalf("expected signature params to be stripped, got %v", request.URL.RawQuery)
+			}
+		})
+	}
+}
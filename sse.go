@@ -0,0 +1,187 @@
+package cube_http_gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	defaultSseKeepAlive  = 15 * time.Second
+	sseSubscriberBuffer  = 64
+	sseLastEventIdHeader = "Last-Event-ID"
+	sseEventPush         = "push"
+)
+
+//Event stream connection, it also receives push messages for its user and device
+type sseConnection struct {
+	*closeSignal
+	id       string
+	identity *identity
+	frames   chan []byte
+}
+
+func (c *sseConnection) connectionId() string {
+	return c.id
+}
+
+func (c *sseConnection) connectionIdentity() *identity {
+	return c.identity
+}
+
+func (c *sseConnection) send(frame []byte) bool {
+	select {
+	case c.frames <- frame:
+		return true
+	default:
+		return false
+	}
+}
+
+//Event data must be single line, json is compacted for that
+func writeSseEvent(writer http.ResponseWriter, id string, event string, data []byte) error {
+	var compacted bytes.Buffer
+
+	err := json.Compact(&compacted, data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		fmt.Fprintf(writer, "id: %v\n", id)
+	}
+
+	_, err = fmt.Fprintf(writer, "event: %v\ndata: %v\n\n", event, compacted.String())
+	return err
+}
+
+func (h *Handler) serveSse(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer,
+			http.StatusText(http.StatusMethodNotAllowed),
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer,
+			http.StatusText(http.StatusInternalServerError),
+			http.StatusInternalServerError)
+		return
+	}
+
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	subjects, err := h.authorizeTopics(identity, request.URL.Query().Get(topicsQueryParam))
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	//EventSource sends last received id on reconnect
+	lastEventId := request.Header.Get(sseLastEventIdHeader)
+	if lastEventId == "" {
+		lastEventId = request.URL.Query().Get("lastEventId")
+	}
+
+	subscription := h.topics.subscribe(subjects, sseSubscriberBuffer)
+	defer h.topics.unsubscribe(subscription)
+
+	connection := &sseConnection{
+		closeSignal: newCloseSignal(),
+		id:          uuid.NewV4().String(),
+		identity:    identity,
+		frames:      make(chan []byte, sseSubscriberBuffer),
+	}
+
+	h.connections.add(connection)
+	defer h.connections.remove(connection)
+
+	h.trackDevice(request, identity)
+
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	//Events published after subscription may also be in replay, they are skipped by id
+	var sentId uint64
+
+	if lastEventId != "" {
+		for _, event := range h.topics.since(subjects, h.topics.parseEventId(lastEventId)) {
+			err = writeSseEvent(writer, h.topics.formatEventId(event.id), subjects[event.subject], event.data)
+			if err != nil {
+				return
+			}
+
+			sentId = event.id
+		}
+	}
+
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(h.sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-subscription.events:
+			if event.id <= sentId {
+				continue
+			}
+
+			err = writeSseEvent(writer, h.topics.formatEventId(event.id), subjects[event.subject], event.data)
+			sentId = event.id
+
+		//Events are dropped for slow client, it reconnects with Last-Event-ID and gets them from replay buffer
+		case <-subscription.closed:
+			return
+
+		case frame := <-connection.frames:
+			err = writeSseEvent(writer, "", sseEventPush, frame)
+
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(writer, ": keep-alive\n\n")
+
+		case <-connection.closed:
+			return
+
+		case <-request.Context().Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (h *Handler) initSse(cubeInstance cube.Cube) error {
+	route := cubeInstance.GetParam("sseRoute")
+	if route == "" {
+		return nil
+	}
+
+	keepAlive, err := getDurationMsParam(cubeInstance, "sseKeepAliveMs", defaultSseKeepAlive)
+	if err != nil {
+		return err
+	}
+
+	h.sseKeepAlive = keepAlive
+	h.addGatewayRoute(Uri(route), h.serveSse)
+	return nil
+}
@@ -0,0 +1,275 @@
+package cube_http_gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akaumov/cube"
+)
+
+//Variable so tests can watch certificate files without waiting
+var certificateReloadInterval = 30 * time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+type certificateFiles struct {
+	certFile string
+	keyFile  string
+}
+
+//Certificates chosen by SNI, reloaded when files are renewed
+type certificateStore struct {
+	mutex        sync.RWMutex
+	files        []certificateFiles
+	certificates []*tls.Certificate
+}
+
+//Format: "cert.pem,key.pem;other-cert.pem,other-key.pem"
+func parseCertificateFiles(rawFiles string) ([]certificateFiles, error) {
+	files := []certificateFiles{}
+
+	if rawFiles == "" {
+		return files, nil
+	}
+
+	for _, rawPair := range strings.Split(rawFiles, ";") {
+		pair := strings.Split(rawPair, ",")
+
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("Wrong tls certificate format: %v\n", rawPair)
+		}
+
+		files = append(files, certificateFiles{certFile: pair[0], keyFile: pair[1]})
+	}
+
+	return files, nil
+}
+
+func loadCertificate(files certificateFiles) (*tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(files.certFile, files.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	//Leaf is needed to match server name
+	certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
+
+func newCertificateStore(files []certificateFiles) (*certificateStore, error) {
+	store := &certificateStore{
+		files:        files,
+		certificates: make([]*tls.Certificate, len(files)),
+	}
+
+	for i := range files {
+		err := store.load(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return store, nil
+}
+
+func (store *certificateStore) load(index int) error {
+	certificate, err := loadCertificate(store.files[index])
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.certificates[index] = certificate
+	return nil
+}
+
+//First certificate is used for clients without SNI or with unknown server name
+func (store *certificateStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, certificate := range store.certificates {
+			if certificate.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return certificate, nil
+			}
+		}
+	}
+
+	return store.certificates[0], nil
+}
+
+func (store *certificateStore) watch(cubeInstance cube.Cube, stop <-chan struct{}) {
+	for i, files := range store.files {
+		index := i
+		certFile := files.certFile
+
+		reload := func() {
+			err := store.load(index)
+			if err != nil {
+				cubeInstance.LogError("Can't reload tls certificate " + certFile + ": " + err.Error())
+				return
+			}
+
+			cubeInstance.LogInfo("Tls certificate is reloaded: " + certFile)
+		}
+
+		//Certificate and key may be renewed in any order, reload fails until both are replaced
+		go watchFile(certFile, certificateReloadInterval, reload, stop)
+		go watchFile(files.keyFile, certificateReloadInterval, reload, stop)
+	}
+}
+
+//Format: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256;TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"
+func parseCipherSuites(rawSuites string) ([]uint16, error) {
+	if rawSuites == "" {
+		return nil, nil
+	}
+
+	suitesByName := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		suitesByName[suite.Name] = suite.ID
+	}
+
+	suites := []uint16{}
+
+	for _, name := range strings.Split(rawSuites, ";") {
+		id, ok := suitesByName[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown or insecure cipher suite: %v\n", name)
+		}
+
+		suites = append(suites, id)
+	}
+
+	return suites, nil
+}
+
+func loadClientCAs(config *tls.Config, clientCaFile string, requireClientCert bool) error {
+	caData, err := ioutil.ReadFile(clientCaFile)
+	if err != nil {
+		return err
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caData) {
+		return fmt.Errorf("no certificates in client ca file: %v", clientCaFile)
+	}
+
+	config.ClientCAs = clientCAs
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return nil
+}
+
+func (h *Handler) initTls(cubeInstance cube.Cube) error {
+	files, err := parseCertificateFiles(cubeInstance.GetParam("tlsCertificates"))
+	if err != nil {
+		return err
+	}
+
+	tlsCertFile := cubeInstance.GetParam("tlsCertFile")
+	if tlsCertFile != "" {
+		files = append([]certificateFiles{{
+			certFile: tlsCertFile,
+			keyFile:  cubeInstance.GetParam("tlsKeyFile"),
+		}}, files...)
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	certificates, err := newCertificateStore(files)
+	if err != nil {
+		return err
+	}
+
+	minVersion := tls.VersionTLS12
+
+	rawMinVersion := cubeInstance.GetParam("tlsMinVersion")
+	if rawMinVersion != "" {
+		version, ok := tlsVersions[rawMinVersion]
+		if !ok {
+			return fmt.Errorf("Wrong tls min version: %v\n", rawMinVersion)
+		}
+
+		minVersion = int(version)
+	}
+
+	cipherSuites, err := parseCipherSuites(cubeInstance.GetParam("tlsCipherSuites"))
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		GetCertificate: certificates.getCertificate,
+		MinVersion:     uint16(minVersion),
+		CipherSuites:   cipherSuites,
+	}
+
+	clientCaFile := cubeInstance.GetParam("clientCaFile")
+	if clientCaFile != "" {
+		err = loadClientCAs(config, clientCaFile, cubeInstance.GetParam("requireClientCert") == "true")
+		if err != nil {
+			return err
+		}
+	}
+
+	certificates.watch(cubeInstance, h.stop)
+
+	h.tlsConfig = config
+	h.tlsRedirectPort = cubeInstance.GetParam("tlsRedirectPort")
+	return nil
+}
+
+//Redirects plain http requests to https port of gateway
+func (h *Handler) newRedirectServer() *http.Server {
+	return &http.Server{
+		Addr: fmt.Sprintf(":%v", h.tlsRedirectPort),
+		Handler: http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			host, _, err := net.SplitHostPort(request.Host)
+			if err != nil {
+				host = request.Host
+			}
+
+			if h.port != 443 {
+				host = net.JoinHostPort(host, strconv.Itoa(h.port))
+			}
+
+			http.Redirect(writer, request, "https://"+host+request.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+}
+
+func (h *Handler) startRedirectServer(cubeInstance cube.Cube) {
+	cubeInstance.LogInfo("Start http redirect listening")
+
+	err := h.redirectServer.ListenAndServe()
+	if err != http.ErrServerClosed {
+		cubeInstance.LogError("Stop http redirect listening: " + err.Error())
+	}
+}
@@ -0,0 +1,202 @@
+package cube_http_gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//Writes self signed certificate for dnsName and its key to dir, returns their files
+func writeTestCertificate(t *testing.T, dir string, dnsName string) certificateFiles {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := certificateFiles{
+		certFile: filepath.Join(dir, dnsName+".pem"),
+		keyFile:  filepath.Join(dir, dnsName+"-key.pem"),
+	}
+
+	err = ioutil.WriteFile(files.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(files.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func TestCertificateStoreSelectsCertificateBySni(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := newCertificateStore([]certificateFiles{
+		writeTestCertificate(t, dir, "a.example.org"),
+		writeTestCertificate(t, dir, "b.example.org"),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverName string
+		dnsName    string
+	}{
+		{"b.example.org", "b.example.org"},
+		{"a.example.org", "a.example.org"},
+		{"unknown.example.org", "a.example.org"},
+		{"", "a.example.org"},
+	}
+
+	for _, test := range tests {
+		certificate, err := store.getCertificate(&tls.ClientHelloInfo{ServerName: test.serverName})
+		if err != nil || certificate.Leaf.Subject.CommonName != test.dnsName {
+			t.Errorf("expected %v for server name %q, got %v %v", test.dnsName, test.serverName, certificate.Leaf.Subject.CommonName, err)
+		}
+	}
+}
+
+func TestInitTlsConfig(t *testing.T) {
+	files := writeTestCertificate(t, t.TempDir(), "gateway.example.org")
+
+	tests := []struct {
+		name         string
+		minVersion   string
+		cipherSuites string
+		ok           bool
+		version      uint16
+		suites       int
+	}{
+		{"defaults", "", "", true, tls.VersionTLS12, 0},
+		{"min version", "1.3", "", true, tls.VersionTLS13, 0},
+		{"cipher suites", "", "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256;TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", true, tls.VersionTLS12, 2},
+		{"wrong min version", "1.4", "", false, 0, 0},
+		{"insecure cipher suite", "", "TLS_RSA_WITH_RC4_128_SHA", false, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeCube{params: map[string]string{
+				"tlsCertFile":     files.certFile,
+				"tlsKeyFile":      files.keyFile,
+				"tlsMinVersion":   test.minVersion,
+				"tlsCipherSuites": test.cipherSuites,
+			}}
+
+			handler := &Handler{}
+			handler.OnInitInstance()
+			t.Cleanup(func() { handler.OnStop(fake) })
+
+			err := handler.initTls(fake)
+
+			if !test.ok {
+				if err == nil {
+					t.Fatal("expected wrong tls config to be rejected")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if handler.tlsConfig.MinVersion != test.version || len(handler.tlsConfig.CipherSuites) != test.suites {
+				t.Fatalf("expected min version %x with %v suites, got %x with %v",
+					test.version, test.suites, handler.tlsConfig.MinVersion, len(handler.tlsConfig.CipherSuites))
+			}
+		})
+	}
+}
+
+func TestCertificateStoreReloadsRenewedFiles(t *testing.T) {
+	defaultInterval := certificateReloadInterval
+	certificateReloadInterval = 10 * time.Millisecond
+	t.Cleanup(func() { certificateReloadInterval = defaultInterval })
+
+	tests := []struct {
+		name        string
+		changedFile func(files certificateFiles) string
+	}{
+		{"certificate is changed", func(files certificateFiles) string { return files.certFile }},
+		{"key is changed", func(files certificateFiles) string { return files.keyFile }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := writeTestCertificate(t, dir, "gateway.example.org")
+
+			store, err := newCertificateStore([]certificateFiles{files})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unchangedFile := files.certFile
+			if test.changedFile(files) == files.certFile {
+				unchangedFile = files.keyFile
+			}
+
+			info, err := os.Stat(unchangedFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store.watch(&fakeCube{}, newTestStop(t))
+
+			oldCertificate, _ := store.getCertificate(&tls.ClientHelloInfo{})
+
+			//Renewed pair is written, only one of files gets new modification time
+			writeTestCertificate(t, dir, "gateway.example.org")
+			os.Chtimes(unchangedFile, info.ModTime(), info.ModTime())
+
+			//Modification time is changed until reload, since watcher may take its first look after renewal
+			for i := 1; i <= 500; i++ {
+				changedModTime := time.Now().Add(time.Duration(i) * time.Second)
+				os.Chtimes(test.changedFile(files), changedModTime, changedModTime)
+
+				certificate, _ := store.getCertificate(&tls.ClientHelloInfo{})
+				if certificate != oldCertificate {
+					return
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			t.Fatal("expected certificate to be reloaded")
+		})
+	}
+}
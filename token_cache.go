@@ -0,0 +1,89 @@
+package cube_http_gateway
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const tokenCacheSize = 10000
+
+type tokenCacheEntry struct {
+	key       string
+	identity  *identity
+	expiresAt time.Time
+}
+
+//Caches token validation results, nil identity means invalid token.
+//Size is capped, least recently used entries are evicted first
+type tokenCache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newTokenCache(size int) *tokenCache {
+	return &tokenCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *tokenCache) get(token string) (*identity, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[hashToken(token)]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*tokenCacheEntry)
+
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, entry.key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.identity, true
+}
+
+func (c *tokenCache) put(token string, identity *identity, expiresAt time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := hashToken(token)
+
+	element, ok := c.entries[key]
+	if ok {
+		entry := element.Value.(*tokenCacheEntry)
+		entry.identity = identity
+		entry.expiresAt = expiresAt
+
+		c.order.MoveToFront(element)
+		return
+	}
+
+	for len(c.entries) >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tokenCacheEntry).key)
+	}
+
+	c.entries[key] = c.order.PushFront(&tokenCacheEntry{
+		key:       key,
+		identity:  identity,
+		expiresAt: expiresAt,
+	})
+}
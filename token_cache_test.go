@@ -0,0 +1,52 @@
+package cube_http_gateway
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTokenCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newTokenCache(2)
+	expiresAt := time.Now().Add(time.Minute)
+	userId := "user"
+
+	cache.put("a", &identity{userId: &userId}, expiresAt)
+	cache.put("b", nil, expiresAt)
+	cache.get("a")
+	cache.put("c", nil, expiresAt)
+
+	if _, ok := cache.get("b"); ok {
+		t.Errorf("expected least recently used token to be evicted")
+	}
+
+	if cachedIdentity, ok := cache.get("a"); !ok || cachedIdentity == nil {
+		t.Errorf("expected recently used token to stay cached")
+	}
+
+	if cachedIdentity, ok := cache.get("c"); !ok || cachedIdentity != nil {
+		t.Errorf("expected invalid token to be cached")
+	}
+}
+
+func TestTokenCacheSizeIsCapped(t *testing.T) {
+	cache := newTokenCache(100)
+	expiresAt := time.Now().Add(time.Minute)
+
+	for i := 0; i < 1000; i++ {
+		cache.put(fmt.Sprint("token", i), nil, expiresAt)
+	}
+
+	if len(cache.entries) != 100 || cache.order.Len() != 100 {
+		t.Errorf("expected 100 entries, got %v", len(cache.entries))
+	}
+}
+
+func TestTokenCacheExpires(t *testing.T) {
+	cache := newTokenCache(10)
+	cache.put("token", nil, time.Now().Add(-time.Second))
+
+	if _, ok := cache.get("token"); ok {
+		t.Errorf("expected expired entry to be dropped")
+	}
+}
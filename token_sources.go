@@ -0,0 +1,133 @@
+package cube_http_gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	tokenSourceHeader = "header"
+	tokenSourceCookie = "cookie"
+	tokenSourceQuery  = "query"
+)
+
+type tokenSource struct {
+	kind string
+	name string
+}
+
+var defaultTokenSources = []tokenSource{
+	{kind: tokenSourceHeader, name: "Authorization"},
+}
+
+//Format: "header;cookie:access_token;query:access_token", sources are checked in order
+func parseTokenSources(rawSources string) ([]tokenSource, error) {
+	if rawSources == "" {
+		return defaultTokenSources, nil
+	}
+
+	sources := []tokenSource{}
+
+	for _, rawSource := range strings.Split(rawSources, ";") {
+		splittedSource := strings.SplitN(rawSource, ":", 2)
+
+		source := tokenSource{kind: splittedSource[0]}
+		if len(splittedSource) == 2 {
+			source.name = splittedSource[1]
+		}
+
+		switch source.kind {
+		case tokenSourceHeader:
+			if source.name == "" {
+				source.name = "Authorization"
+			}
+		case tokenSourceCookie, tokenSourceQuery:
+			if source.name == "" {
+				return nil, fmt.Errorf("Token source without name: %v\n", rawSource)
+			}
+		default:
+			return nil, fmt.Errorf("Unknown token source: %v\n", rawSource)
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+//Removes query param so it is not forwarded to backends
+func stripQueryParam(request *http.Request, name string) {
+	query := request.URL.Query()
+	query.Del(name)
+
+	request.URL.RawQuery = query.Encode()
+	stripRequestUriParam(request, name)
+}
+
+//Removes query param from RequestURI only, request URL keeps it
+func stripRequestUriParam(request *http.Request, name string) {
+	requestUri, err := url.ParseRequestURI(request.RequestURI)
+	if err != nil {
+		return
+	}
+
+	query := requestUri.Query()
+	if _, ok := query[name]; !ok {
+		return
+	}
+
+	query.Del(name)
+	requestUri.RawQuery = query.Encode()
+	request.RequestURI = requestUri.RequestURI()
+}
+
+//Query tokens are removed from RequestURI of every request whichever source authenticates it,
+//so they are not forwarded to backends or logged. Token is still read from request URL
+func (h *Handler) stripQueryTokens(request *http.Request) {
+	for _, source := range h.tokenSources {
+		if source.kind == tokenSourceQuery {
+			stripRequestUriParam(request, source.name)
+		}
+	}
+}
+
+//Query tokens are accepted only on queryTokenRoutes
+func (h *Handler) extractToken(request *http.Request) (string, *tokenSource) {
+	for i := range h.tokenSources {
+		source := &h.tokenSources[i]
+
+		switch source.kind {
+		case tokenSourceHeader:
+			token := request.Header.Get(source.name)
+			if token == "" || strings.HasPrefix(token, "Basic ") || strings.HasPrefix(token, hmacAuthScheme+" ") {
+				continue
+			}
+
+			return strings.TrimPrefix(token, "Bearer "), source
+
+		case tokenSourceCookie:
+			cookie, err := request.Cookie(source.name)
+			if err != nil || cookie.Value == "" {
+				continue
+			}
+
+			return cookie.Value, source
+
+		case tokenSourceQuery:
+			if !matchAnyUri(h.queryTokenRoutes, requestPath(request)) {
+				continue
+			}
+
+			token := request.URL.Query().Get(source.name)
+			if token == "" {
+				continue
+			}
+
+			return token, source
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,334 @@
+package cube_http_gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	webhookMethod = "webhook"
+
+	//Signature header carries timestamp and signatures: "t=1492774577,v1=hex"
+	webhookFormatStripe = "stripe"
+
+	defaultWebhookPayload     = "{body}"
+	defaultWebhookTolerance   = 5 * 60
+	defaultWebhookDedupWindow = 24 * 60 * 60
+	maxWebhookBodySize        = 5 << 20
+)
+
+var webhookAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+//Github: signatureHeader X-Hub-Signature-256, signaturePrefix "sha256=", deliveryIdHeader X-GitHub-Delivery.
+//Slack: timestampHeader X-Slack-Request-Timestamp, signedPayload "v0:{timestamp}:{body}", signaturePrefix "v0="
+type webhook struct {
+	Route            Uri        `json:"route"`
+	Subject          BusSubject `json:"subject"`
+	Secret           string     `json:"secret"`
+	Algorithm        string     `json:"algorithm"`
+	Encoding         string     `json:"encoding"`
+	Format           string     `json:"format"`
+	SignatureHeader  string     `json:"signatureHeader"`
+	SignaturePrefix  string     `json:"signaturePrefix"`
+	TimestampHeader  string     `json:"timestampHeader"`
+	SignedPayload    string     `json:"signedPayload"`
+	ToleranceSeconds int64      `json:"toleranceSeconds"`
+	DeliveryIdHeader string     `json:"deliveryIdHeader"`
+	DedupSeconds     int64      `json:"dedupSeconds"`
+
+	newHash func() hash.Hash
+}
+
+const (
+	webhookDeliveriesPruneInterval = time.Minute
+	//Delivery which is being published is forgotten after this time if publishing never returns
+	webhookInFlightTtl = time.Minute
+)
+
+func loadWebhooks(path string) ([]*webhook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhooks []*webhook
+
+	err = json.Unmarshal(data, &webhooks)
+	if err != nil {
+		return nil, fmt.Errorf("wrong webhooks file: %v", err)
+	}
+
+	for _, hook := range webhooks {
+		if hook.Route == "" || hook.Subject == "" || hook.Secret == "" || hook.SignatureHeader == "" {
+			return nil, fmt.Errorf("webhook without route, subject, secret or signature header")
+		}
+
+		if hook.Algorithm == "" {
+			hook.Algorithm = "sha256"
+		}
+
+		hook.newHash = webhookAlgorithms[hook.Algorithm]
+		if hook.newHash == nil {
+			return nil, fmt.Errorf("wrong webhook algorithm: %v", hook.Algorithm)
+		}
+
+		if hook.Encoding == "" {
+			hook.Encoding = "hex"
+		}
+
+		if hook.Encoding != "hex" && hook.Encoding != "base64" {
+			return nil, fmt.Errorf("wrong webhook encoding: %v", hook.Encoding)
+		}
+
+		if hook.SignedPayload == "" {
+			hook.SignedPayload = defaultWebhookPayload
+
+			if hook.TimestampHeader != "" || hook.Format == webhookFormatStripe {
+				hook.SignedPayload = "{timestamp}.{body}"
+			}
+		}
+
+		if hook.ToleranceSeconds == 0 {
+			hook.ToleranceSeconds = defaultWebhookTolerance
+		}
+
+		if hook.DedupSeconds == 0 {
+			hook.DedupSeconds = defaultWebhookDedupWindow
+		}
+	}
+
+	return webhooks, nil
+}
+
+func (hook *webhook) decodeSignature(signature string) ([]byte, error) {
+	signature = strings.TrimPrefix(strings.TrimSpace(signature), hook.SignaturePrefix)
+
+	if hook.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(signature)
+	}
+
+	return hex.DecodeString(signature)
+}
+
+//Returns timestamp and candidate signatures, stripe format may list several signatures during secret rotation
+func (hook *webhook) parseSignatureHeader(request *http.Request) (string, []string) {
+	header := request.Header.Get(hook.SignatureHeader)
+	timestamp := ""
+	signatures := []string{}
+
+	if hook.Format != webhookFormatStripe {
+		if hook.TimestampHeader != "" {
+			timestamp = request.Header.Get(hook.TimestampHeader)
+		}
+
+		return timestamp, append(signatures, header)
+	}
+
+	for _, field := range strings.Split(header, ",") {
+		pair := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
+
+		switch pair[0] {
+		case "t":
+			timestamp = pair[1]
+		case "v1":
+			signatures = append(signatures, pair[1])
+		}
+	}
+
+	return timestamp, signatures
+}
+
+func (hook *webhook) verify(request *http.Request, body []byte) error {
+	timestamp, signatures := hook.parseSignatureHeader(request)
+
+	usesTimestamp := strings.Contains(hook.SignedPayload, "{timestamp}")
+	if usesTimestamp {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("wrong webhook timestamp")
+		}
+
+		if math.Abs(float64(time.Now().Unix()-seconds)) > float64(hook.ToleranceSeconds) {
+			return fmt.Errorf("webhook timestamp is out of tolerance")
+		}
+	}
+
+	payload := strings.Replace(hook.SignedPayload, "{timestamp}", timestamp, -1)
+	parts := strings.SplitN(payload, "{body}", 2)
+
+	mac := hmac.New(hook.newHash, []byte(hook.Secret))
+	mac.Write([]byte(parts[0]))
+
+	if len(parts) == 2 {
+		mac.Write(body)
+		mac.Write([]byte(parts[1]))
+	}
+
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		decoded, err := hook.decodeSignature(signature)
+		if err != nil {
+			continue
+		}
+
+		if hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("wrong webhook signature")
+}
+
+func (h *Handler) serveWebhook(hook *webhook) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodPost {
+			http.Error(writer,
+				http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(writer, request.Body, maxWebhookBodySize))
+		if err != nil {
+			http.Error(writer,
+				http.StatusText(http.StatusRequestEntityTooLarge),
+				http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		err = hook.verify(request, body)
+		if err != nil {
+			h.cubeInstance.LogWarning("Webhook " + string(hook.Route) + " is rejected: " + err.Error())
+			http.Error(writer,
+				http.StatusText(http.StatusUnauthorized),
+				http.StatusUnauthorized)
+			return
+		}
+
+		deliveryId := ""
+		if hook.DeliveryIdHeader != "" {
+			deliveryId = request.Header.Get(hook.DeliveryIdHeader)
+		}
+
+		deliveryKey := string(hook.Route) + "\n" + deliveryId
+
+		if deliveryId != "" {
+			status := h.startWebhookDelivery(deliveryKey)
+			if status != 0 {
+				writer.WriteHeader(status)
+				return
+			}
+
+			defer h.webhookInFlight.remove(deliveryKey)
+		}
+
+		messageId := deliveryId
+		if messageId == "" {
+			messageId = uuid.NewV4().String()
+		}
+
+		packedParams, err := json.Marshal(js.WebhookParams{
+			Route:      string(hook.Route),
+			DeliveryId: deliveryId,
+			Headers:    request.Header,
+			Body:       body,
+			ReceivedAt: time.Now().Unix(),
+		})
+
+		if err != nil {
+			http.Error(writer,
+				http.StatusText(http.StatusInternalServerError),
+				http.StatusInternalServerError)
+			return
+		}
+
+		err = h.cubeInstance.PublishMessage(cube.Channel(hook.Subject), cube.Message{
+			Id:     messageId,
+			Method: webhookMethod,
+			Params: (*json.RawMessage)(&packedParams),
+		})
+
+		//Delivery is remembered only when it is published, so provider retry of failed one is accepted
+		if err != nil {
+			h.cubeInstance.LogError("Can't publish webhook: " + err.Error())
+			http.Error(writer,
+				http.StatusText(http.StatusServiceUnavailable),
+				http.StatusServiceUnavailable)
+			return
+		}
+
+		if deliveryId != "" {
+			h.webhookDeliveries.add(deliveryKey, time.Now().Add(time.Duration(hook.DedupSeconds)*time.Second))
+		}
+
+		writer.WriteHeader(http.StatusAccepted)
+	}
+}
+
+//Marks delivery as in flight. Returns status to answer without publishing:
+//200 for delivered one so provider stops retrying, 409 while the same delivery is being published
+func (h *Handler) startWebhookDelivery(deliveryKey string) int {
+	if h.webhookDeliveries.contains(deliveryKey) {
+		return http.StatusOK
+	}
+
+	if !h.webhookInFlight.add(deliveryKey, time.Now().Add(webhookInFlightTtl)) {
+		return http.StatusConflict
+	}
+
+	//Delivery may be finished between the checks
+	if h.webhookDeliveries.contains(deliveryKey) {
+		h.webhookInFlight.remove(deliveryKey)
+		return http.StatusOK
+	}
+
+	return 0
+}
+
+func (h *Handler) initWebhooks(cubeInstance cube.Cube) error {
+	webhooksFile := cubeInstance.GetParam("webhooksFile")
+	if webhooksFile == "" {
+		return nil
+	}
+
+	webhooks, err := loadWebhooks(webhooksFile)
+	if err != nil {
+		cubeInstance.LogError("Wrong webhooks file")
+		return err
+	}
+
+	//Delivery ids published within dedup window and ids being published
+	h.webhookDeliveries = newExpiringSet(webhookDeliveriesPruneInterval, h.stop)
+	h.webhookInFlight = newExpiringSet(webhookDeliveriesPruneInterval, h.stop)
+
+	for _, hook := range webhooks {
+		h.addGatewayRoute(hook.Route, h.serveWebhook(hook))
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package cube_http_gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testWebhookSecret = "webhook-secret"
+	testWebhookBody   = `{"event":"push"}`
+)
+
+func newTestWebhookHandler(t *testing.T) (*Handler, *fakeCube) {
+	webhooksFile := filepath.Join(t.TempDir(), "webhooks.json")
+
+	err := ioutil.WriteFile(webhooksFile, []byte(`[
+		{
+			"route": "/hooks/github",
+			"subject": "github",
+			"secret": "`+testWebhookSecret+`",
+			"signatureHeader": "X-Hub-Signature-256",
+			"signaturePrefix": "sha256=",
+			"deliveryIdHeader": "X-GitHub-Delivery"
+		},
+		{
+			"route": "/hooks/stripe",
+			"subject": "stripe",
+			"secret": "`+testWebhookSecret+`",
+			"format": "stripe",
+			"signatureHeader": "Stripe-Signature"
+		}
+	]`), 0600)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestHandler(t, map[string]string{"webhooksFile": webhooksFile})
+}
+
+func signTestWebhook(payload string) string {
+	mac := hmac.New(sha256.New, []byte(testWebhookSecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sendTestGithubWebhook(handler *Handler, signature string, deliveryId string) int {
+	request := httptest.NewRequest("POST", "/hooks/github", strings.NewReader(testWebhookBody))
+	request.Header.Set("X-Hub-Signature-256", "sha256="+signature)
+	request.Header.Set("X-GitHub-Delivery", deliveryId)
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	return writer.Code
+}
+
+func sendTestStripeWebhook(handler *Handler, timestamp int64) int {
+	payload := fmt.Sprintf("%v.%v", timestamp, testWebhookBody)
+
+	request := httptest.NewRequest("POST", "/hooks/stripe", strings.NewReader(testWebhookBody))
+	request.Header.Set("Stripe-Signature", fmt.Sprintf("t=%v,v1=%v,v1=%v", timestamp, signTestWebhook("old"), signTestWebhook(payload)))
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	return writer.Code
+}
+
+func TestWebhookSignature(t *testing.T) {
+	handler, fake := newTestWebhookHandler(t)
+
+	if status := sendTestGithubWebhook(handler, signTestWebhook(testWebhookBody), "first"); status != http.StatusAccepted {
+		t.Fatalf("expected 202 for valid signature, got %v", status)
+	}
+
+	if status := sendTestGithubWebhook(handler, signTestWebhook(testWebhookBody+" "), "second"); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for wrong signature, got %v", status)
+	}
+
+	if status := sendTestStripeWebhook(handler, time.Now().Unix()); status != http.StatusAccepted {
+		t.Fatalf("expected 202 for valid stripe signature, got %v", status)
+	}
+
+	if status := sendTestStripeWebhook(handler, time.Now().Add(-time.Hour).Unix()); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for timestamp out of tolerance, got %v", status)
+	}
+
+	if published := len(fake.publishedMessages("github")) + len(fake.publishedMessages("stripe")); published != 2 {
+		t.Fatalf("expected 2 published webhooks, got %v", published)
+	}
+}
+
+func TestWebhookDeliveryIsPublishedOnce(t *testing.T) {
+	handler, fake := newTestWebhookHandler(t)
+	signature := signTestWebhook(testWebhookBody)
+
+	if status := sendTestGithubWebhook(handler, signature, "delivery"); status != http.StatusAccepted {
+		t.Fatalf("expected 202, got %v", status)
+	}
+
+	if status := sendTestGithubWebhook(handler, signature, "delivery"); status != http.StatusOK {
+		t.Fatalf("expected 200 for retried delivery, got %v", status)
+	}
+
+	if published := len(fake.publishedMessages("github")); published != 1 {
+		t.Fatalf("expected delivery to be published once, got %v", published)
+	}
+}
+
+func TestWebhookDeliveryInFlightIsConflict(t *testing.T) {
+	handler, fake := newTestWebhookHandler(t)
+
+	handler.webhookInFlight.add("/hooks/github\ndelivery", time.Now().Add(time.Minute))
+
+	if status := sendTestGithubWebhook(handler, signTestWebhook(testWebhookBody), "delivery"); status != http.StatusConflict {
+		t.Fatalf("expected 409 while delivery is published, got %v", status)
+	}
+
+	if published := len(fake.publishedMessages("github")); published != 0 {
+		t.Fatalf("expected nothing to be published, got %v", published)
+	}
+}
+
+func TestFailedWebhookDeliveryCanBeRetried(t *testing.T) {
+	handler, fake := newTestWebhookHandler(t)
+	signature := signTestWebhook(testWebhookBody)
+
+	fake.publishErr = errors.New("bus is down")
+
+	if status := sendTestGithubWebhook(handler, signature, "delivery"); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 when publish fails, got %v", status)
+	}
+
+	fake.publishErr = nil
+
+	if status := sendTestGithubWebhook(handler, signature, "delivery"); status != http.StatusAccepted {
+		t.Fatalf("expected retry to be published, got %v", status)
+	}
+
+	if published := len(fake.publishedMessages("github")); published != 1 {
+		t.Fatalf("expected one published delivery, got %v", published)
+	}
+}
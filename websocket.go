@@ -0,0 +1,337 @@
+package cube_http_gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/akaumov/cube"
+	"github.com/akaumov/cube-http-gateway/js"
+	"github.com/gorilla/websocket"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	WebSocketChannel = "gateway.ws"
+
+	webSocketSendBuffer   = 64
+	webSocketWriteTimeout = 10 * time.Second
+	webSocketPongTimeout  = 60 * time.Second
+	webSocketPingInterval = 50 * time.Second
+	webSocketMaxFrameSize = 1 << 20
+
+	webSocketFrameMessage  = "message"
+	webSocketFrameResponse = "response"
+	webSocketFrameError    = "error"
+)
+
+type webSocketConnection struct {
+	id       string
+	identity *identity
+	conn     *websocket.Conn
+	sendChan chan []byte
+	done     chan struct{}
+}
+
+func (c *webSocketConnection) connectionId() string {
+	return c.id
+}
+
+func (c *webSocketConnection) connectionIdentity() *identity {
+	return c.identity
+}
+
+func (c *webSocketConnection) send(frame []byte) bool {
+	select {
+	case c.sendChan <- frame:
+		return true
+	case <-c.done:
+		return false
+	default:
+		//Slow client, frame is dropped
+		return false
+	}
+}
+
+//Read loop fails on closed connection and cleans it up
+func (c *webSocketConnection) close() {
+	c.conn.Close()
+}
+
+func (c *webSocketConnection) sendFrame(frame js.WebSocketFrame) {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return
+	}
+
+	c.send(data)
+}
+
+func (c *webSocketConnection) writeLoop() {
+	ticker := time.NewTicker(webSocketPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case frame := <-c.sendChan:
+			c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+
+			err := c.conn.WriteMessage(websocket.TextMessage, frame)
+			if err != nil {
+				c.conn.Close()
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+
+			err := c.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				c.conn.Close()
+				return
+			}
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (h *Handler) serveWebSocket(writer http.ResponseWriter, request *http.Request) {
+	identity, err := h.authenticate(writer, request)
+	if err != nil {
+		writeStatusError(writer, err)
+		return
+	}
+
+	if identity == nil {
+		http.Error(writer,
+			http.StatusText(http.StatusUnauthorized),
+			http.StatusUnauthorized)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(request *http.Request) bool {
+			if identity.tokenSource != tokenSourceCookie || h.csrf == nil {
+				return true
+			}
+
+			return h.csrf.checkOrigin(request) == nil
+		},
+	}
+
+	conn, err := upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		return
+	}
+
+	connection := &webSocketConnection{
+		id:       uuid.NewV4().String(),
+		identity: identity,
+		conn:     conn,
+		sendChan: make(chan []byte, webSocketSendBuffer),
+		done:     make(chan struct{}),
+	}
+
+	h.connections.add(connection)
+	h.trackDevice(request, identity)
+
+	if h.devMode {
+		fmt.Println("WebSocket connected:", connection.id)
+	}
+
+	go connection.writeLoop()
+	h.webSocketReadLoop(connection)
+
+	h.connections.remove(connection)
+	close(connection.done)
+	conn.Close()
+
+	if h.devMode {
+		fmt.Println("WebSocket disconnected:", connection.id)
+	}
+}
+
+func (h *Handler) webSocketReadLoop(connection *webSocketConnection) {
+	conn := connection.conn
+
+	conn.SetReadLimit(webSocketMaxFrameSize)
+	conn.SetReadDeadline(time.Now().Add(webSocketPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(webSocketPongTimeout))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(webSocketPongTimeout))
+
+		var frame js.WebSocketFrame
+
+		err = json.Unmarshal(data, &frame)
+		if err != nil {
+			connection.sendFrame(js.WebSocketFrame{
+				Type:  webSocketFrameError,
+				Error: &cube.Error{Name: "WrongFrame", Message: err.Error()},
+			})
+			continue
+		}
+
+		if frame.Reply {
+			go h.callFromWebSocket(connection, frame)
+			continue
+		}
+
+		h.publishFromWebSocket(connection, frame)
+	}
+}
+
+func (h *Handler) packWebSocketParams(connection *webSocketConnection, frame js.WebSocketFrame) (*json.RawMessage, error) {
+	identity := connection.identity
+
+	packedParams, err := json.Marshal(js.WebSocketParams{
+		ConnectionId: connection.id,
+		UserId:       identity.userId,
+		DeviceId:     identity.deviceId,
+		ClientId:     identity.clientId,
+		Params:       frame.Params,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return (*json.RawMessage)(&packedParams), nil
+}
+
+func (h *Handler) checkWebSocketSubject(connection *webSocketConnection, frame js.WebSocketFrame) bool {
+	if frame.Subject != "" && matchAnySubject(h.webSocketSubjects, BusSubject(frame.Subject)) {
+		return true
+	}
+
+	connection.sendFrame(js.WebSocketFrame{
+		Type:  webSocketFrameError,
+		Id:    frame.Id,
+		Error: &cube.Error{Name: "Forbidden", Message: "subject is not allowed"},
+	})
+
+	return false
+}
+
+func (h *Handler) publishFromWebSocket(connection *webSocketConnection, frame js.WebSocketFrame) {
+	if !h.checkWebSocketSubject(connection, frame) {
+		return
+	}
+
+	params, err := h.packWebSocketParams(connection, frame)
+	if err != nil {
+		return
+	}
+
+	messageId := frame.Id
+	if messageId == "" {
+		messageId = uuid.NewV4().String()
+	}
+
+	err = h.cubeInstance.PublishMessage(cube.Channel(frame.Subject), cube.Message{
+		Id:     messageId,
+		Method: frame.Method,
+		Params: params,
+	})
+
+	if err != nil {
+		connection.sendFrame(js.WebSocketFrame{
+			Type:  webSocketFrameError,
+			Id:    frame.Id,
+			Error: &cube.Error{Name: "Unavailable", Message: err.Error()},
+		})
+	}
+}
+
+func (h *Handler) callFromWebSocket(connection *webSocketConnection, frame js.WebSocketFrame) {
+	if !h.checkWebSocketSubject(connection, frame) {
+		return
+	}
+
+	params, err := h.packWebSocketParams(connection, frame)
+	if err != nil {
+		return
+	}
+
+	timeout := time.Duration(h.timeoutMs) * time.Millisecond
+
+	response, err := h.cubeInstance.CallMethod(cube.Channel(frame.Subject), cube.Request{
+		Method: frame.Method,
+		Params: params,
+	}, timeout)
+
+	if err != nil {
+		name := "Unavailable"
+		if err == cube.ErrorTimeout {
+			name = "Timeout"
+		}
+
+		connection.sendFrame(js.WebSocketFrame{
+			Type:  webSocketFrameError,
+			Id:    frame.Id,
+			Error: &cube.Error{Name: name, Message: err.Error()},
+		})
+		return
+	}
+
+	connection.sendFrame(js.WebSocketFrame{
+		Type:   webSocketFrameResponse,
+		Id:     frame.Id,
+		Result: response.Result,
+		Error:  response.Error,
+	})
+}
+
+//Writes bus message to connection it is addressed to
+func (h *Handler) onWebSocketMessage(instance cube.Cube, message cube.Message) {
+	if message.Params == nil {
+		return
+	}
+
+	var params js.WebSocketMessageParams
+
+	err := json.Unmarshal(*message.Params, &params)
+	if err != nil {
+		instance.LogError("Wrong websocket message: " + err.Error())
+		return
+	}
+
+	//Connection may be held by another gateway instance
+	connection := h.connections.get(params.ConnectionId)
+	if connection == nil {
+		return
+	}
+
+	data, err := json.Marshal(js.WebSocketFrame{
+		Type:   webSocketFrameMessage,
+		Id:     message.Id,
+		Method: message.Method,
+		Params: params.Data,
+	})
+
+	if err != nil {
+		return
+	}
+
+	connection.send(data)
+}
+
+func (h *Handler) initWebSocket(cubeInstance cube.Cube) {
+	route := cubeInstance.GetParam("webSocketRoute")
+	if route == "" {
+		return
+	}
+
+	h.webSocketSubjects = parseSubjectList(cubeInstance.GetParam("webSocketSubjects"))
+	h.addGatewayRoute(Uri(route), h.serveWebSocket)
+}